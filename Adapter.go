@@ -1,9 +1,11 @@
 package ws
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"strings"
+	"sync"
 )
 
 type (
@@ -16,6 +18,9 @@ type (
 		requestID  int64
 		sent       bool
 		multiSend  bool
+		sendMutex  sync.Mutex
+		params     map[string]string
+		ctx        context.Context
 	}
 	// NetContext is used network context, like *tokay.Context, *gin.Context, echo.Context etc.
 	NetContext interface{}
@@ -23,12 +28,24 @@ type (
 
 // NewAdapter makes new *Adapter instance
 func newAdapter(command string, connection *Connection, data *[]byte, requestID int64) *Adapter {
-	return &Adapter{
+	a := &Adapter{
 		command:    command,
 		connection: connection,
 		data:       data,
 		requestID:  requestID,
 	}
+	a.ctx = newMessageContext(a)
+	return a
+}
+
+// Ctx returns context.Context of message handling: it is cancelled when connection
+// is closed or handler deadline is exceeded and has connection ID, user ID, command and request ID values
+// (see ConnIDFromContext, UserIDFromContext, CommandFromContext and RequestIDFromContext)
+func (a *Adapter) Ctx() context.Context {
+	if a.ctx == nil {
+		return context.Background()
+	}
+	return a.ctx
 }
 
 // Data returns client message
@@ -61,18 +78,64 @@ func (a *Adapter) Command() string {
 	return a.command
 }
 
+// Param returns command parameter of handler pattern ("id" of "orders/:id/update", "path" of "files/*path")
+func (a *Adapter) Param(name string) string {
+	return a.params[name]
+}
+
+// Params returns all command parameters of handler pattern
+func (a *Adapter) Params() map[string]string {
+	return a.params
+}
+
 // Send message to open connection
 func (a *Adapter) Send(message interface{}) error {
-	if a.sent && !a.multiSend{
+	if !a.markSent() {
 		return fmt.Errorf("Adaper already sent")
 	}
-	a.sent = true
 	if a.client != nil {
 		return a.client.Send(a.command, message, a.requestID)
 	}
 	return a.connection.Send(a.command, message, a.requestID)
 }
 
+// SendError replies to the request with error (*Error or any error with ErrCodeInternal code)
+func (a *Adapter) SendError(err error) error {
+	if a.requestID == 0 {
+		return nil
+	}
+	if !a.markSent() {
+		return fmt.Errorf("Adaper already sent")
+	}
+	if a.client != nil {
+		return a.client.Send(errorCommand, toError(err), a.requestID)
+	}
+	return a.connection.sendError(a.command, a.requestID, toError(err))
+}
+
+// markSent returns false if answer was already sent
+func (a *Adapter) markSent() bool {
+	a.sendMutex.Lock()
+	defer a.sendMutex.Unlock()
+	if a.sent && !a.multiSend {
+		return false
+	}
+	a.sent = true
+	return true
+}
+
+// reply returns answer data of the request or *Error if error was replied
+func (a *Adapter) reply() ([]byte, error) {
+	if a.command == errorCommand {
+		e := &Error{}
+		if err := a.JSONData(e); err != nil {
+			return []byte{}, err
+		}
+		return []byte{}, e
+	}
+	return a.Data(), nil
+}
+
 // Connection returns adapter connect instance
 func (a *Adapter) Connection() *Connection {
 	return a.connection
@@ -88,6 +151,21 @@ func (a *Adapter) Subscribers(commands string) Connections {
 	return a.connection.Subscribers(commands)
 }
 
+// Set connection session value
+func (a *Adapter) Set(key string, val interface{}) {
+	if a.connection != nil {
+		a.connection.Set(key, val)
+	}
+}
+
+// Get connection session value
+func (a *Adapter) Get(key string) (val interface{}, exists bool) {
+	if a.connection != nil {
+		return a.connection.Get(key)
+	}
+	return nil, false
+}
+
 // User returns connection user
 func (a *Adapter) User() *User {
 	return a.connection.User()
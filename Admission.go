@@ -0,0 +1,163 @@
+package ws
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type (
+	// UpgradeError is reason of connection refusal before WebSocket handshake
+	UpgradeError struct {
+		Status     int // HTTP status code
+		RetryAfter time.Duration
+		Message    string
+	}
+
+	// connSlots counts admitted connections of channel, users and remote IPs (for connection limits)
+	connSlots struct {
+		sync.Mutex
+		total int
+		users map[interface{}]int
+		ips   map[string]int
+	}
+
+	// slot is place of admitted connection in connection limits
+	slot struct {
+		userID interface{}
+		ip     string
+	}
+)
+
+// closeTryAgainLater is close code of connections refused after handshake
+const closeTryAgainLater = 1013
+
+// ErrTooManyUserConnections is returned by Connection.SetUser if user has Channel.MaxConnectionsPerUser connections
+var ErrTooManyUserConnections = errors.New("too many user connections")
+
+func (e *UpgradeError) Error() string {
+	return fmt.Sprintf("%s (status %d)", e.Message, e.Status)
+}
+
+// RetryAfterHeader returns "Retry-After" header value in seconds (empty if not needed)
+func (e *UpgradeError) RetryAfterHeader() string {
+	if e.RetryAfter <= 0 {
+		return ""
+	}
+	return fmt.Sprint(int64(math.Ceil(e.RetryAfter.Seconds())))
+}
+
+// Admit checks connection limits for new connection of user from remote address (before upgrade)
+func (channel *Channel) Admit(userID interface{}, remoteAddr string) *UpgradeError {
+	retryAfter := channel.RetryAfter
+	if retryAfter <= 0 {
+		retryAfter = time.Second
+	}
+
+	if channel.closed {
+		return &UpgradeError{Status: http.StatusServiceUnavailable, Message: "channel closed"}
+	}
+	s := channel.slots
+	s.Lock()
+	defer s.Unlock()
+	if channel.MaxConnections > 0 && s.total >= channel.MaxConnections {
+		return &UpgradeError{Status: http.StatusServiceUnavailable, RetryAfter: retryAfter, Message: "too many connections"}
+	}
+	if channel.MaxConnectionsPerUser > 0 && userID != nil && s.users[userID] >= channel.MaxConnectionsPerUser {
+		return &UpgradeError{Status: http.StatusTooManyRequests, RetryAfter: retryAfter, Message: "too many user connections"}
+	}
+	if ip := hostOnly(remoteAddr); channel.MaxConnectionsPerIP > 0 && ip != "" && s.ips[ip] >= channel.MaxConnectionsPerIP {
+		return &UpgradeError{Status: http.StatusTooManyRequests, RetryAfter: retryAfter, Message: "too many connections from address"}
+	}
+	return nil
+}
+
+func newConnSlots() *connSlots {
+	return &connSlots{users: make(map[interface{}]int), ips: make(map[string]int)}
+}
+
+// reserve takes slot of just upgraded connection in connection limits (false if limits are exceeded).
+// Concurrent upgrades passed Admit are checked again here, so only overflowing connections are refused.
+func (channel *Channel) reserve(c *Connection) bool {
+	var userID interface{}
+	if user := c.User(); user != nil {
+		userID = user.ID()
+	}
+	s := channel.slots
+	s.Lock()
+	defer s.Unlock()
+	if c.isClosed() ||
+		channel.MaxConnections > 0 && s.total >= channel.MaxConnections ||
+		channel.MaxConnectionsPerUser > 0 && userID != nil && s.users[userID] >= channel.MaxConnectionsPerUser ||
+		channel.MaxConnectionsPerIP > 0 && c.remoteIP != "" && s.ips[c.remoteIP] >= channel.MaxConnectionsPerIP {
+		return false
+	}
+	s.total++
+	if userID != nil {
+		s.users[userID]++
+	}
+	if c.remoteIP != "" {
+		s.ips[c.remoteIP]++
+	}
+	c.slot = &slot{userID: userID, ip: c.remoteIP}
+	return true
+}
+
+// release frees slot of closed connection
+func (channel *Channel) release(c *Connection) {
+	s := channel.slots
+	s.Lock()
+	defer s.Unlock()
+	if c.slot == nil {
+		return
+	}
+	s.total--
+	s.releaseUser(c.slot.userID)
+	if c.slot.ip != "" {
+		if s.ips[c.slot.ip]--; s.ips[c.slot.ip] <= 0 {
+			delete(s.ips, c.slot.ip)
+		}
+	}
+	c.slot = nil
+}
+
+// moveSlot moves slot of connection to user with userID (false if user connections limit is exceeded)
+func (channel *Channel) moveSlot(c *Connection, userID interface{}) bool {
+	s := channel.slots
+	s.Lock()
+	defer s.Unlock()
+	if c.slot == nil || c.slot.userID == userID {
+		return true
+	}
+	if channel.MaxConnectionsPerUser > 0 && userID != nil && s.users[userID] >= channel.MaxConnectionsPerUser {
+		return false
+	}
+	s.releaseUser(c.slot.userID)
+	if userID != nil {
+		s.users[userID]++
+	}
+	c.slot.userID = userID
+	return true
+}
+
+// releaseUser decrements connections count of user
+func (s *connSlots) releaseUser(userID interface{}) {
+	if userID == nil {
+		return
+	}
+	if s.users[userID]--; s.users[userID] <= 0 {
+		delete(s.users, userID)
+	}
+}
+
+// hostOnly removes port from address
+func hostOnly(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
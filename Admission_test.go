@@ -0,0 +1,194 @@
+package ws
+
+import (
+	"encoding/binary"
+	"io"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	gorillaWebsocket "github.com/gorilla/websocket"
+)
+
+// recordConn is websocket connection which records written messages (reading is blocked until it is closed)
+type recordConn struct {
+	mutex     sync.Mutex
+	types     []int
+	messages  []string
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newRecordConn() *recordConn {
+	return &recordConn{done: make(chan struct{})}
+}
+
+func (r *recordConn) SetReadLimit(int64) {}
+
+func (r *recordConn) ReadMessage() (int, []byte, error) {
+	<-r.done
+	return 0, nil, io.EOF
+}
+
+func (r *recordConn) Close() error {
+	r.closeOnce.Do(func() { close(r.done) })
+	return nil
+}
+
+func (r *recordConn) WriteMessage(messageType int, data []byte) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.types = append(r.types, messageType)
+	r.messages = append(r.messages, string(data))
+	return nil
+}
+
+// written returns messages written to connection of testConnection
+func written(c *Connection) []string {
+	r := c.conn.(*recordConn)
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]string{}, r.messages...)
+}
+
+// closeCode returns code of close frame written to connection (0 if there is no close frame with code)
+func (r *recordConn) closeCode() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for i, t := range r.types {
+		if t == gorillaWebsocket.CloseMessage && len(r.messages[i]) >= 2 {
+			return int(binary.BigEndian.Uint16([]byte(r.messages[i])))
+		}
+	}
+	return 0
+}
+
+// testConnection registers connection of user from IP like Channel.Handler does (without read loop)
+func testConnection(channel *Channel, connID uint64, userID interface{}, ip string) (*Connection, bool) {
+	c := newConnection(connID, channel, newRecordConn(), nil, &HandshakeInfo{Header: http.Header{}, RemoteIP: ip, userID: userID})
+	return c, channel.reserve(c)
+}
+
+func TestSetUserMovesSlot(t *testing.T) {
+	channel := NewChannel()
+	channel.MaxConnectionsPerUser = 1
+	a, _ := testConnection(channel, 1, "a", "")
+	b, _ := testConnection(channel, 2, "b", "")
+	c, _ := testConnection(channel, 3, "c", "")
+
+	if err := b.SetUser("a"); err != ErrTooManyUserConnections {
+		t.Fatalf("SetUser to full user = %v; want ErrTooManyUserConnections", err)
+	}
+	if id := b.User().ID(); id != "b" {
+		t.Fatalf("refused SetUser changed user to %v", id)
+	}
+
+	a.Close()
+	if err := b.SetUser("a"); err != nil {
+		t.Fatalf("SetUser = %v; want nil", err)
+	}
+	if got := channel.slots.users; len(got) != 2 || got["a"] != 1 || got["c"] != 1 {
+		t.Fatalf("user slots = %v; want map[a:1 c:1]", got)
+	}
+	if err := channel.Admit("b", ""); err != nil {
+		t.Fatalf("Admit of user without connections = %v; want nil", err)
+	}
+	if err := c.SetUser("a"); err != ErrTooManyUserConnections {
+		t.Fatalf("SetUser to rebound user = %v; want ErrTooManyUserConnections", err)
+	}
+}
+
+func TestReserveOverflow(t *testing.T) {
+	tests := []struct {
+		name         string
+		limits       func(channel *Channel)
+		conns        []slot // users and IPs of concurrent connections
+		wantAccepted int
+	}{
+		{
+			name:         "total",
+			limits:       func(channel *Channel) { channel.MaxConnections = 3 },
+			conns:        []slot{{"a", "1.1.1.1"}, {"b", "1.1.1.2"}, {"c", "1.1.1.3"}, {"d", "1.1.1.4"}, {nil, ""}},
+			wantAccepted: 3,
+		},
+		{
+			name:         "per user",
+			limits:       func(channel *Channel) { channel.MaxConnectionsPerUser = 2 },
+			conns:        []slot{{"a", ""}, {"a", ""}, {"a", ""}, {"a", ""}, {"b", ""}, {nil, ""}, {nil, ""}},
+			wantAccepted: 5,
+		},
+		{
+			name:         "per IP",
+			limits:       func(channel *Channel) { channel.MaxConnectionsPerIP = 1 },
+			conns:        []slot{{"a", "1.1.1.1"}, {"b", "1.1.1.1"}, {"c", "1.1.1.2"}, {"d", ""}},
+			wantAccepted: 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			channel := NewChannel()
+			tt.limits(channel)
+			conns := make([]*recordConn, len(tt.conns))
+			returned := make([]chan struct{}, len(tt.conns))
+			for i, s := range tt.conns {
+				conns[i], returned[i] = newRecordConn(), make(chan struct{})
+				info := &HandshakeInfo{Header: http.Header{}, RemoteIP: s.ip, userID: s.userID}
+				go func(i int) {
+					channel.Handler(conns[i], nil, info)
+					close(returned[i])
+				}(i)
+			}
+
+			refused := func() (n int) {
+				for _, r := range returned {
+					select {
+					case <-r:
+						n++
+					default:
+					}
+				}
+				return
+			}
+			total := func() int {
+				channel.slots.Lock()
+				defer channel.slots.Unlock()
+				return channel.slots.total
+			}
+			for deadline := time.Now().Add(time.Second); refused()+total() < len(tt.conns) && time.Now().Before(deadline); {
+				time.Sleep(time.Millisecond)
+			}
+
+			if n := total(); n != tt.wantAccepted {
+				t.Fatalf("%d connections reserved slots; want %d", n, tt.wantAccepted)
+			}
+			for i, r := range returned {
+				select {
+				case <-r:
+					if code := conns[i].closeCode(); code != closeTryAgainLater {
+						t.Fatalf("refused connection is closed with code %d; want %d", code, closeTryAgainLater)
+					}
+				default:
+					if code := conns[i].closeCode(); code != 0 {
+						t.Fatalf("accepted connection is closed with code %d", code)
+					}
+				}
+			}
+			if n := channel.connMap.Len(); n != tt.wantAccepted {
+				t.Fatalf("%d connections are registered; want %d", n, tt.wantAccepted)
+			}
+
+			for _, c := range channel.connMap.Copy() {
+				c.Close()
+			}
+			for _, r := range returned {
+				<-r
+			}
+			channel.slots.Lock()
+			defer channel.slots.Unlock()
+			if s := channel.slots; s.total != 0 || len(s.users) != 0 || len(s.ips) != 0 {
+				t.Fatalf("slots after Close: total %d, users %v, IPs %v; want none", s.total, s.users, s.ips)
+			}
+		})
+	}
+}
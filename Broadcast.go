@@ -0,0 +1,257 @@
+package ws
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+
+	gorillaWebsocket "github.com/gorilla/websocket"
+	websocket "github.com/night-codes/tokay-websocket"
+)
+
+type (
+	// preparedMessage is broadcast message encoded once for each wire format
+	preparedMessage struct {
+		sync.Mutex
+		command string
+		message interface{}
+		frames  map[frameKey]*preparedFrame
+	}
+
+	frameKey struct {
+		wsClient  bool
+		namespace string
+		msgType   int
+	}
+
+	preparedFrame struct {
+		data     []byte
+		err      error
+		msgType  int
+		once     sync.Once
+		prepared *gorillaWebsocket.PreparedMessage // nil if message can't be prepared
+	}
+
+	// ConnectionError is error of one connection in broadcast
+	ConnectionError struct {
+		ConnID uint64
+		Err    error
+	}
+
+	// ConnectionErrors are errors of connections (errors.Is and errors.As match any of them)
+	ConnectionErrors []*ConnectionError
+
+	// BroadcastError is returned by broadcast Send methods when delivery to some connections failed
+	BroadcastError struct {
+		ConnectionErrors
+	}
+
+	// DeliveryReport of broadcast message
+	DeliveryReport struct {
+		Delivered int
+		Failed    int
+		Errors    []*ConnectionError
+	}
+
+	// preparedWriter is implemented by connections with prepared messages support (gorilla)
+	preparedWriter interface {
+		WritePreparedMessage(pm *gorillaWebsocket.PreparedMessage) error
+	}
+)
+
+// ErrConnectionClosed is returned when message is sent to closed connection
+var ErrConnectionClosed = errors.New("connection already closed")
+
+func (e *ConnectionError) Error() string {
+	return fmt.Sprintf("Connect %d: %v", e.ConnID, e.Err)
+}
+
+// Unwrap returns underlying error
+func (e *ConnectionError) Unwrap() error {
+	return e.Err
+}
+
+func (e ConnectionErrors) Error() string {
+	strs := make([]string, len(e))
+	for i, err := range e {
+		strs[i] = err.Error()
+	}
+	return strings.Join(strs, "\n")
+}
+
+// Unwrap returns connections errors (for errors.Is and errors.As)
+func (e ConnectionErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
+
+// Is reports whether any connection error matches target (errors.Is doesn't use Unwrap() []error before Go 1.20)
+func (e ConnectionErrors) Is(target error) bool {
+	for _, err := range e {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first connection error that matches target (errors.As doesn't use Unwrap() []error before Go 1.20)
+func (e ConnectionErrors) As(target interface{}) bool {
+	for _, err := range e {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// ConnIDs returns IDs of failed connections
+func (e ConnectionErrors) ConnIDs() []uint64 {
+	ids := make([]uint64, len(e))
+	for i, err := range e {
+		ids[i] = err.ConnID
+	}
+	return ids
+}
+
+// Err returns *BroadcastError if delivery to some connections failed (or nil)
+func (r DeliveryReport) Err() error {
+	if len(r.Errors) == 0 {
+		return nil
+	}
+	return &BroadcastError{ConnectionErrors: r.Errors}
+}
+
+func newPreparedMessage(command string, message interface{}) *preparedMessage {
+	return &preparedMessage{
+		command: command,
+		message: message,
+		frames:  make(map[frameKey]*preparedFrame),
+	}
+}
+
+// frame returns message encoded for connection format (encodes it on first call)
+func (pm *preparedMessage) frame(wsClient bool, namespace string, msgType int) *preparedFrame {
+	pm.Lock()
+	defer pm.Unlock()
+
+	key := frameKey{wsClient: wsClient, namespace: namespace, msgType: msgType}
+	if f, ok := pm.frames[key]; ok {
+		return f
+	}
+	f := &preparedFrame{msgType: msgType}
+	f.data, f.err = encodeMessage(wsClient, namespace, pm.command, pm.message, 0, 0)
+	pm.frames[key] = f
+	return f
+}
+
+// gorilla returns frame prepared for gorilla connections (it is created on first call, so
+// broadcasts to connections of other libraries don't build it)
+func (f *preparedFrame) gorilla() *gorillaWebsocket.PreparedMessage {
+	f.once.Do(func() {
+		f.prepared, _ = gorillaWebsocket.NewPreparedMessage(f.msgType, f.data)
+	})
+	return f.prepared
+}
+
+// messageType of channel messages
+func (channel *Channel) messageType() int {
+	if channel.root().UseBinary {
+		return websocket.BinaryMessage
+	}
+	return websocket.TextMessage
+}
+
+// sendPrepared sends broadcast message to open connect
+func (c *Connection) sendPrepared(pm *preparedMessage) error {
+	if c.isClosed() {
+		return ErrConnectionClosed
+	}
+
+	f := pm.frame(c.wsClient, c.Namespace(), c.channel.messageType())
+	if f.err != nil {
+		return fmt.Errorf("json.Marshal: %v", f.err)
+	}
+	if pw, ok := c.conn.(preparedWriter); ok {
+		if prepared := f.gorilla(); prepared != nil {
+			c.writeMutex.Lock()
+			defer c.writeMutex.Unlock()
+			if cw, ok := c.conn.(interface{ EnableWriteCompression(bool) }); ok {
+				cw.EnableWriteCompression(len(f.data) >= c.channel.CompressionThreshold)
+			}
+			return pw.WritePreparedMessage(prepared)
+		}
+	}
+	return c.write(f.data)
+}
+
+// broadcast sends message to connections: each wire format is encoded once and
+// messages are written with bounded parallelism (Channel.BroadcastConcurrency)
+func broadcast(conns map[uint64]*Connection, command string, message interface{}) DeliveryReport {
+	report := DeliveryReport{}
+	if message == nil || len(conns) == 0 {
+		return report
+	}
+	pm := newPreparedMessage(command, message)
+
+	var reportMutex sync.Mutex
+	send := func(connection *Connection) {
+		err := connection.sendPrepared(pm)
+		reportMutex.Lock()
+		if err != nil {
+			report.Failed++
+			report.Errors = append(report.Errors, &ConnectionError{ConnID: connection.ID(), Err: err})
+		} else {
+			report.Delivered++
+		}
+		reportMutex.Unlock()
+	}
+
+	workers := broadcastConcurrency(conns)
+	if workers == 1 {
+		for _, connection := range conns {
+			send(connection)
+		}
+	} else {
+		jobs := make(chan *Connection)
+		var wg sync.WaitGroup
+		wg.Add(workers)
+		for i := 0; i < workers; i++ {
+			go func() {
+				defer wg.Done()
+				for connection := range jobs {
+					send(connection)
+				}
+			}()
+		}
+		for _, connection := range conns {
+			jobs <- connection
+		}
+		close(jobs)
+		wg.Wait()
+	}
+	return report
+}
+
+// broadcastConcurrency returns number of broadcast workers
+func broadcastConcurrency(conns map[uint64]*Connection) int {
+	n := 0
+	for _, connection := range conns {
+		if connection.channel != nil {
+			n = connection.channel.broadcastConcurrency()
+		}
+		break
+	}
+	if n <= 0 {
+		n = runtime.GOMAXPROCS(0)
+	}
+	if n > len(conns) {
+		n = len(conns)
+	}
+	return n
+}
@@ -0,0 +1,142 @@
+package ws
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	gorillaWebsocket "github.com/gorilla/websocket"
+)
+
+// nopConn is websocket connection which discards written messages
+type nopConn struct{}
+
+func (nopConn) SetReadLimit(int64)                {}
+func (nopConn) ReadMessage() (int, []byte, error) { select {} }
+func (nopConn) WriteMessage(int, []byte) error    { return nil }
+func (nopConn) Close() error                      { return nil }
+
+// benchChannel returns channel with n connections (half of them are ws.Client connections)
+func benchChannel(n int) *Channel {
+	channel := NewChannel()
+	for i := 0; i < n; i++ {
+		header := http.Header{}
+		if i%2 == 0 {
+			header.Set("ws-client", "1")
+		}
+		newConnection(uint64(i+1), channel, nopConn{}, nil, &HandshakeInfo{Header: header})
+	}
+	return channel
+}
+
+var benchMessage = Map{"items": make([]int, 500), "name": "snapshot", "nested": Map{"a": 1, "b": []string{"x", "y", "z"}}}
+
+// BenchmarkSendLoop is sending to each connection (message is encoded for every connection)
+func BenchmarkSendLoop(b *testing.B) {
+	channel := benchChannel(5000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, c := range channel.connMap.Copy() {
+			c.Send("cmd", benchMessage)
+		}
+	}
+}
+
+// BenchmarkBroadcast is Channel.Send (message is encoded once for each connection format)
+func BenchmarkBroadcast(b *testing.B) {
+	channel := benchChannel(5000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		channel.Send("cmd", benchMessage)
+	}
+}
+
+// gorillaChannel returns channel with n gorilla connections of httptest server (half of them are ws.Client
+// connections) and function which closes them. Clients discard received messages.
+func gorillaChannel(b *testing.B, n int) (*Channel, func()) {
+	channel := NewChannel()
+	upgrader := gorillaWebsocket.Upgrader{}
+	conns := make(chan *gorillaWebsocket.Conn)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if conn, err := upgrader.Upgrade(w, r, nil); err == nil {
+			conns <- conn
+		}
+	}))
+
+	clients := make([]*gorillaWebsocket.Conn, n)
+	for i := 0; i < n; i++ {
+		client, _, err := gorillaWebsocket.DefaultDialer.Dial("ws"+srv.URL[4:], nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+		clients[i] = client
+		go func() {
+			for {
+				_, r, err := client.NextReader()
+				if err != nil {
+					return
+				}
+				io.Copy(io.Discard, r)
+			}
+		}()
+
+		header := http.Header{}
+		if i%2 == 0 {
+			header.Set("ws-client", "1")
+		}
+		newConnection(uint64(i+1), channel, <-conns, nil, &HandshakeInfo{Header: header})
+	}
+	return channel, func() {
+		for _, c := range channel.connMap.Copy() {
+			c.Close()
+		}
+		for _, client := range clients {
+			client.Close()
+		}
+		srv.Close()
+	}
+}
+
+// BenchmarkSendLoopGorilla is sending to each gorilla connection
+func BenchmarkSendLoopGorilla(b *testing.B) {
+	channel, closeAll := gorillaChannel(b, 500)
+	defer closeAll()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, c := range channel.connMap.Copy() {
+			c.Send("cmd", benchMessage)
+		}
+	}
+}
+
+// BenchmarkBroadcastGorilla is Channel.Send to gorilla connections (frames are prepared once for each format)
+func BenchmarkBroadcastGorilla(b *testing.B) {
+	channel, closeAll := gorillaChannel(b, 500)
+	defer closeAll()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		channel.Send("cmd", benchMessage)
+	}
+}
+
+func TestPreparedFrameLazy(t *testing.T) {
+	channel := benchChannel(4)
+	pm := newPreparedMessage("cmd", benchMessage)
+	for _, c := range channel.connMap.Copy() {
+		if err := c.sendPrepared(pm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(pm.frames) != 2 {
+		t.Fatalf("%d frames are encoded; want 2 (JSON and ws.Client formats)", len(pm.frames))
+	}
+	for key, f := range pm.frames {
+		if f.prepared != nil {
+			t.Fatalf("frame %+v is prepared for connections without WritePreparedMessage", key)
+		}
+		if f.gorilla() == nil || f.gorilla() != f.prepared {
+			t.Fatalf("frame %+v isn't prepared once on demand", key)
+		}
+	}
+}
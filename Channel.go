@@ -2,25 +2,73 @@ package ws
 
 import (
 	"bytes"
-	"errors"
-	"fmt"
+	"context"
+	"net"
 	"strings"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/night-codes/conv"
+	websocket "github.com/night-codes/tokay-websocket"
 )
 
 // Channel is websocket route
 type (
 	Channel struct {
-		connMap   *connMap
-		users     *usersMap
-		subscrs   *subscrMap
-		readers   *readersMap
-		requests  *requestsMap
-		closeCh   chan bool
-		closed    bool
-		UseBinary bool
+		connMap        *connMap
+		users          *usersMap
+		subscrs        *subscrMap
+		readers        *readersMap
+		requests       *requestsMap
+		mws            *middlewareList
+		limiter        *rateLimiter
+		ips            *subscrMap // connections by remote IP
+		authenticator  Authenticator
+		trustedProxies []*net.IPNet
+		closeCh        chan bool
+		closed         bool
+		parent         *Channel // parent of namespace
+		namespace      string   // full namespace name ("" for root channel)
+		namespaces     map[string]*Channel
+		nsMutex        sync.RWMutex
+		timeouts       map[string]time.Duration // handler timeouts of commands
+		timeoutsMutex  sync.RWMutex
+		overruns       uint64
+		requestID      int64 // last ID of requests to clients (unique across connections)
+		reliable       *reliableQueue
+		slots          *connSlots
+		UseBinary      bool
+
+		// MaxConnections is limit of channel connections (0 is unlimited)
+		MaxConnections int
+		// MaxConnectionsPerUser is limit of connections of one user (0 is unlimited, anonymous users are not limited)
+		MaxConnectionsPerUser int
+		// MaxConnectionsPerIP is limit of connections from one remote IP (0 is unlimited)
+		MaxConnectionsPerIP int
+		// RetryAfter is "Retry-After" duration of refused upgrades (1 second by default)
+		RetryAfter time.Duration
+
+		// CompressionLevel of negotiated permessage-deflate (flate.BestSpeed...flate.BestCompression, 0 is default level)
+		CompressionLevel int
+		// CompressionThreshold is minimal size of compressed messages (smaller messages are sent uncompressed)
+		CompressionThreshold int
+
+		// BroadcastConcurrency is number of parallel writers of broadcast messages (parent one or GOMAXPROCS by default)
+		BroadcastConcurrency int
+
+		// HandlerTimeout is default deadline of command handlers (0 is unlimited or parent one for namespaces, see SetCommandTimeout)
+		HandlerTimeout time.Duration
+
+		// RetransmitInterval of unacknowledged reliable messages (5 seconds by default)
+		RetransmitInterval time.Duration
+		// ReliableTTL is time reliable messages are kept until acknowledgement (1 hour by default)
+		ReliableTTL time.Duration
+
+		// OnPanic is called after recovery of handler panic (parent one is used by namespaces without it)
+		OnPanic PanicHandler
+		// DisableRecovery turns off handlers panic recovery (of namespaces too)
+		DisableRecovery bool
 	}
 
 	messageStruct struct {
@@ -40,43 +88,59 @@ var nextConnID uint64
 
 // NewChannel creates new ws.Channel
 func NewChannel() *Channel {
-	return &Channel{
-		connMap:  newConnMap(),
-		users:    newUsersMap(),
-		subscrs:  newSubscrMap(),
-		readers:  newReaderMap(),
-		requests: newRequestsMap(),
-		closeCh:  make(chan bool),
+	channel := &Channel{
+		connMap:    newConnMap(),
+		users:      newUsersMap(),
+		subscrs:    newSubscrMap(),
+		readers:    newReaderMap(),
+		requests:   newRequestsMap(),
+		mws:        newMiddlewareList(),
+		limiter:    newRateLimiter(),
+		ips:        newSubscrMap(),
+		namespaces: map[string]*Channel{},
+		timeouts:   map[string]time.Duration{},
+		closeCh:    make(chan bool),
+		slots:      newConnSlots(),
 	}
+	channel.reliable = newReliableQueue(channel)
+	channel.subscribeReader()
+	channel.authReader()
+	channel.ackReader()
+	return channel
 }
 
-// Handler add websocket handler
-func (channel *Channel) Handler(conn ConnIface, context NetContext) {
+// Handler add websocket handler (info is result of Channel.Prepare)
+func (channel *Channel) Handler(conn ConnIface, context NetContext, info ...*HandshakeInfo) {
 	if channel.closed {
 		return
 	}
-	connection := newConnection(atomic.AddUint64(&nextConnID, 1), channel, conn, context)
-	channel.subscribeReader()
-	go func() {
-		if fns, exists := channel.readers.GetEx("ws-server-connect"); exists {
-			adapter := newAdapter("ws-server-connect", connection, nil, 0)
-			adapter.multiSend = true
-			for _, fn := range fns {
-				fn(adapter)
-			}
-		}
-	}()
+	var handshake *HandshakeInfo
+	if len(info) > 0 {
+		handshake = info[0]
+	}
+	connection := newConnection(atomic.AddUint64(&nextConnID, 1), channel, conn, context, handshake)
+	if !channel.reserve(connection) {
+		connection.CloseWithReason(closeTryAgainLater, "too many connections")
+		return
+	}
+	go channel.hook("ws-server-connect", connection)
+	go channel.reliable.resend(connection)
 	channel.readLoop(conn, connection)
-	go func() {
-		if fns, exists := channel.readers.GetEx("ws-server-disconnect"); exists {
-			adapter := newAdapter("ws-server-disconnect", connection, nil, 0)
+	go channel.hook("ws-server-disconnect", connection)
+	connection.Close()
+}
+
+// hook runs connect ("ws-server-connect") or disconnect ("ws-server-disconnect") handlers
+func (channel *Channel) hook(command string, connection *Connection) {
+	if fns, exists := channel.readers.GetEx(command); exists {
+		adapter := newAdapter(command, connection, nil, 0)
+		if command == "ws-server-connect" {
+			adapter.multiSend = true
+		} else {
 			adapter.sent = true
-			for _, fn := range fns {
-				fn(adapter)
-			}
 		}
-	}()
-	connection.Close()
+		channel.dispatch(adapter, fns)
+	}
 }
 
 func (channel *Channel) readLoop(conn ConnIface, connection *Connection) {
@@ -96,20 +160,7 @@ func (channel *Channel) readLoop(conn ConnIface, connection *Connection) {
 			go func(message []byte) {
 				var result = bytes.SplitN(message, []byte(":"), 3)
 				if len(result) == 3 {
-					requestID := conv.Int64(result[0])
-					command := string(result[1])
-					data := result[2]
-					if requestID < 0 { // answer to the request from server
-						if fn, ex := channel.requests.GetEx(requestID); ex {
-							fn(newAdapter(command, connection, &data, requestID))
-							channel.requests.Delete(requestID)
-						}
-					} else if fns, exists := channel.readers.GetEx(command); exists {
-						adapter := newAdapter(command, connection, &data, requestID)
-						for _, fn := range fns {
-							fn(adapter)
-						}
-					}
+					channel.process(connection, conv.Int64(result[0]), string(result[1]), result[2])
 				}
 			}(result.Message)
 		case channel.closed = <-channel.closeCh:
@@ -118,19 +169,156 @@ func (channel *Channel) readLoop(conn ConnIface, connection *Connection) {
 	}
 }
 
-// Read is client message (request) handler
-func (channel *Channel) Read(command string, fn func(*Adapter)) {
-	channel.readers.Set(command, fn)
+// process routes client message to namespace, request callback or command handlers
+func (channel *Channel) process(connection *Connection, requestID int64, command string, data []byte) {
+	if requestID >= 0 && !channel.limiter.Allow(connection, command) {
+		channel.rateLimited(connection, command, requestID)
+		return
+	}
+	if name, cmd := splitNamespace(command); name != "" {
+		if ns, ok := channel.getNamespace(name); ok {
+			if connection, ok = ns.join(connection); ok && cmd != namespaceJoin {
+				ns.process(connection, requestID, cmd, data)
+			}
+			return
+		} else if cmd == namespaceJoin {
+			return
+		}
+	}
+
+	if requestID < 0 { // answer to the request from server
+		if fn, ex := channel.requests.GetEx(requestID); ex {
+			fn(newAdapter(command, connection, &data, requestID))
+			channel.requests.Delete(requestID)
+		}
+	} else if fns, params, pattern, exists := channel.readers.Match(command); exists {
+		adapter := newAdapter(command, connection, &data, requestID)
+		adapter.params = params
+		channel.run(adapter, fns, channel.commandTimeout(pattern))
+	} else if fns, exists := channel.readers.GetEx(notFoundCommand); exists {
+		channel.run(newAdapter(command, connection, &data, requestID), fns, channel.handlerTimeout())
+	} else if requestID > 0 {
+		connection.sendError(command, requestID, unknownCommand(command))
+	}
+}
+
+// SetRateLimits sets inbound messages limits (per connection, user, IP and command) and resets limiter state
+func (channel *Channel) SetRateLimits(limits RateLimits) {
+	channel.limiter.SetLimits(limits)
+}
+
+// rateLimited makes rate limit overflow action
+func (channel *Channel) rateLimited(connection *Connection, command string, requestID int64) {
+	switch channel.limiter.Action() {
+	case RateLimitReply:
+		if requestID > 0 {
+			connection.sendError(command, requestID, NewError(ErrCodeRateLimit, "rate limit exceeded"))
+		}
+	case RateLimitClose:
+		connection.CloseWithReason(websocket.ClosePolicyViolation, "rate limit exceeded")
+	}
+}
+
+// dispatch runs command handlers wrapped with middlewares of channel and its parents
+func (channel *Channel) dispatch(adapter *Adapter, fns []Handler) {
+	if !channel.recoveryDisabled() {
+		defer func() {
+			if rec := recover(); rec != nil {
+				recoverHandler(adapter, rec, channel.onPanic())
+			}
+		}()
+	}
+	channel.wrap(func(a *Adapter) {
+		for _, fn := range fns {
+			fn(a)
+		}
+	})(adapter)
+}
+
+// run dispatches command handlers with deadline: when it is exceeded, request gets ErrCodeTimeout
+// error reply, Adapter.Ctx() is cancelled and overrun is counted (handlers are not interrupted)
+func (channel *Channel) run(adapter *Adapter, fns []Handler, timeout time.Duration) {
+	if timeout <= 0 {
+		channel.dispatch(adapter, fns)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(adapter.Ctx(), timeout)
+	adapter.ctx = ctx
+	var finished int32
+	overrun := func() {
+		if atomic.CompareAndSwapInt32(&finished, 0, 1) && ctx.Err() == context.DeadlineExceeded {
+			atomic.AddUint64(&channel.overruns, 1)
+			adapter.SendError(NewError(ErrCodeTimeout, "handler timeout"))
+		}
+	}
+	go func() {
+		<-ctx.Done()
+		overrun()
+	}()
+	channel.dispatch(adapter, fns)
+	overrun()
+	cancel()
+}
+
+// SetCommandTimeout sets handler deadline of command or pattern (overrides HandlerTimeout, 0 is unlimited)
+func (channel *Channel) SetCommandTimeout(command string, timeout time.Duration) {
+	channel.timeoutsMutex.Lock()
+	channel.timeouts[command] = timeout
+	channel.timeoutsMutex.Unlock()
+}
+
+func (channel *Channel) commandTimeout(command string) time.Duration {
+	channel.timeoutsMutex.RLock()
+	defer channel.timeoutsMutex.RUnlock()
+	if timeout, ok := channel.timeouts[command]; ok {
+		return timeout
+	}
+	return channel.handlerTimeout()
+}
+
+// TimeoutOverruns returns number of handlers which exceeded their deadlines
+func (channel *Channel) TimeoutOverruns() uint64 {
+	return atomic.LoadUint64(&channel.overruns)
 }
 
-// AddConnectFunc add new Connect handler
-func (channel *Channel) AddConnectFunc(fn func(a *Adapter)) {
-	channel.readers.Set("ws-server-connect", fn)
+// Read is client message (request) handler.
+// Command can be pattern with parameters and wildcard: "orders/:id/update", "files/*path" (see Adapter.Param)
+// It returns function which removes the handler.
+func (channel *Channel) Read(command string, fn func(*Adapter), middlewares ...Middleware) (off func()) {
+	return channel.readers.handle(command, chain(fn, middlewares))
 }
 
-// AddDisconnectFunc add new Disconnect handler
-func (channel *Channel) AddDisconnectFunc(fn func(a *Adapter)) {
-	channel.readers.Set("ws-server-disconnect", fn)
+// Off removes all handlers of command (or pattern)
+func (channel *Channel) Off(command string) {
+	channel.readers.Delete(command)
+}
+
+// NotFound sets handler of messages with unknown commands
+// (by default requests with unknown commands get ErrCodeNotFound error reply)
+func (channel *Channel) NotFound(fn func(*Adapter), middlewares ...Middleware) {
+	channel.readers.Delete(notFoundCommand)
+	channel.readers.Set(notFoundCommand, chain(fn, middlewares))
+}
+
+// Use adds middlewares for all channel handlers
+func (channel *Channel) Use(middlewares ...Middleware) {
+	channel.mws.Add(middlewares...)
+}
+
+// Group creates group of commands with common prefix and middlewares
+func (channel *Channel) Group(prefix string, middlewares ...Middleware) *Group {
+	return newGroup(channel, prefix, middlewares)
+}
+
+// AddConnectFunc add new Connect handler (returns function which removes the handler)
+func (channel *Channel) AddConnectFunc(fn func(a *Adapter)) (off func()) {
+	return channel.readers.handle("ws-server-connect", fn)
+}
+
+// AddDisconnectFunc add new Disconnect handler (returns function which removes the handler)
+func (channel *Channel) AddDisconnectFunc(fn func(a *Adapter)) (off func()) {
+	return channel.readers.handle("ws-server-disconnect", fn)
 }
 
 // Close ws instance connections
@@ -146,7 +334,7 @@ func (channel *Channel) Close() {
 func (channel *Channel) User(userID interface{}) *User {
 	user, ok := channel.users.GetEx(userID)
 	if !ok {
-		user = newUser(userID)
+		user = newUser(userID, channel)
 	}
 	return user
 }
@@ -160,18 +348,14 @@ func (channel *Channel) Connection(connID uint64) *Connection {
 	return connection
 }
 
-// Send message to open connections
+// Send message to open connections (returns *BroadcastError if some of them failed)
 func (channel *Channel) Send(command string, message interface{}) error {
-	errStr := ""
-	for _, connection := range channel.connMap.Copy() {
-		if err := connection.Send(command, message); err != nil {
-			errStr += fmt.Sprintf("Connect %d: %v/n", connection.ID(), err)
-		}
-	}
-	if errStr != "" {
-		return errors.New(errStr)
-	}
-	return nil
+	return channel.SendReport(command, message).Err()
+}
+
+// SendReport sends message to open connections and returns delivery report
+func (channel *Channel) SendReport(command string, message interface{}) DeliveryReport {
+	return broadcast(channel.connMap.Copy(), command, message)
 }
 
 // Subscribers of commands ("command1,command2" etc.)
@@ -194,6 +378,32 @@ func (channel *Channel) subscribeReader() {
 	})
 }
 
+// All returns all channel connections
+func (channel *Channel) All() Connections {
+	return Connections{connMap: &connMap{connects: channel.connMap.Copy()}}
+}
+
+// ByOrigin returns connections with origin
+func (channel *Channel) ByOrigin(origin string) Connections {
+	return channel.All().ByOrigin(origin)
+}
+
+// ByUser returns connections of user
+func (channel *Channel) ByUser(userID interface{}) Connections {
+	ret := newConnections()
+	if user, ok := channel.users.GetEx(userID); ok {
+		for _, connection := range user.connMap.Copy() {
+			ret.Add(connection)
+		}
+	}
+	return ret
+}
+
+// ByLabel returns connections with one of labels
+func (channel *Channel) ByLabel(labels ...string) Connections {
+	return channel.All().ByLabel(labels...)
+}
+
 // GetConnects from Channel
 func (channel *Channel) GetConnects() (connectIDs map[uint64]*Connection) {
 	return channel.connMap.Copy()
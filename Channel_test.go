@@ -0,0 +1,193 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+)
+
+// replies returns data and error replies written to connection of testConnection
+func replies(c *Connection) (data []string, errs []*Error) {
+	for _, msg := range written(c) {
+		reply := struct {
+			Data  json.RawMessage
+			Error *Error
+		}{}
+		if json.Unmarshal([]byte(msg), &reply) != nil {
+			continue
+		}
+		if reply.Error != nil {
+			errs = append(errs, reply.Error)
+		} else {
+			data = append(data, string(reply.Data))
+		}
+	}
+	return
+}
+
+func TestHandlerTimeout(t *testing.T) {
+	const timeout = 20 * time.Millisecond
+	tests := []struct {
+		name         string
+		requestID    int64
+		handler      func(a *Adapter)
+		wantData     []string
+		wantTimeout  bool
+		wantOverruns uint64
+		wantCtxErr   error // Adapter.Ctx().Err() after handler
+	}{
+		{
+			name:       "reply in time",
+			requestID:  1,
+			handler:    func(a *Adapter) { a.Send("ok") },
+			wantData:   []string{`"ok"`},
+			wantCtxErr: nil,
+		},
+		{
+			name:       "no reply in time",
+			requestID:  1,
+			handler:    func(a *Adapter) {},
+			wantCtxErr: nil,
+		},
+		{
+			name:      "reply before overrun",
+			requestID: 1,
+			handler: func(a *Adapter) {
+				a.Send("ok")
+				<-a.Ctx().Done()
+			},
+			wantData:     []string{`"ok"`},
+			wantOverruns: 1,
+			wantCtxErr:   context.DeadlineExceeded,
+		},
+		{
+			name:      "overrun",
+			requestID: 1,
+			handler: func(a *Adapter) {
+				<-a.Ctx().Done()
+				time.Sleep(timeout)
+				a.Send("late")
+			},
+			wantTimeout:  true,
+			wantOverruns: 1,
+			wantCtxErr:   context.DeadlineExceeded,
+		},
+		{
+			name:         "overrun of message without request",
+			requestID:    0,
+			handler:      func(a *Adapter) { <-a.Ctx().Done() },
+			wantOverruns: 1,
+			wantCtxErr:   context.DeadlineExceeded,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			channel := NewChannel()
+			channel.HandlerTimeout = timeout
+			c, _ := testConnection(channel, 1, nil, "")
+			var ctxErr error
+			channel.Read("cmd", func(a *Adapter) {
+				tt.handler(a)
+				ctxErr = a.Ctx().Err()
+			})
+
+			channel.process(c, tt.requestID, "cmd", []byte(`""`))
+			time.Sleep(3 * timeout) // no reply is sent after handler is finished
+
+			data, errs := replies(c)
+			if len(data) != len(tt.wantData) || len(data) > 0 && data[0] != tt.wantData[0] {
+				t.Fatalf("data replies %v; want %v", data, tt.wantData)
+			}
+			if tt.wantTimeout != (len(errs) == 1 && errs[0].Code == ErrCodeTimeout) || len(errs) > 1 {
+				t.Fatalf("error replies %v; want timeout reply: %v", errs, tt.wantTimeout)
+			}
+			if n := channel.TimeoutOverruns(); n != tt.wantOverruns {
+				t.Fatalf("TimeoutOverruns() = %d; want %d", n, tt.wantOverruns)
+			}
+			if ctxErr != tt.wantCtxErr {
+				t.Fatalf("Adapter.Ctx().Err() = %v; want %v", ctxErr, tt.wantCtxErr)
+			}
+		})
+	}
+}
+
+func TestHandlerTimeoutOverrunOnce(t *testing.T) {
+	const requests = 300
+	channel := NewChannel()
+	channel.HandlerTimeout = time.Millisecond
+	conns := make([]*Connection, requests)
+	for i := range conns {
+		conns[i], _ = testConnection(channel, uint64(i+1), nil, "")
+	}
+	channel.Read("cmd", func(a *Adapter) {
+		time.Sleep(time.Millisecond) // finishes about the deadline
+	})
+
+	var wg sync.WaitGroup
+	for _, c := range conns {
+		wg.Add(1)
+		go func(c *Connection) {
+			defer wg.Done()
+			channel.process(c, 1, "cmd", []byte(`""`))
+		}(c)
+	}
+	wg.Wait()
+	time.Sleep(10 * time.Millisecond)
+
+	timeouts := 0
+	for _, c := range conns {
+		if n := len(written(c)); n > 1 {
+			t.Fatalf("%d replies to request; want at most 1", n)
+		}
+		_, errs := replies(c)
+		timeouts += len(errs)
+	}
+	if n := channel.TimeoutOverruns(); n != uint64(timeouts) {
+		t.Fatalf("TimeoutOverruns() = %d; want %d (number of timeout replies)", n, timeouts)
+	}
+}
+
+func TestAdapterCtxDisconnect(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout time.Duration
+	}{
+		{"without deadline", 0},
+		{"with deadline", time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			channel := NewChannel()
+			channel.HandlerTimeout = tt.timeout
+			c, _ := testConnection(channel, 1, nil, "")
+			started := make(chan struct{})
+			var ctxErr error
+			channel.Read("cmd", func(a *Adapter) {
+				close(started)
+				select {
+				case <-a.Ctx().Done():
+					ctxErr = a.Ctx().Err()
+				case <-time.After(time.Second / 2):
+				}
+			})
+
+			done := make(chan struct{})
+			go func() {
+				channel.process(c, 1, "cmd", []byte(`""`))
+				close(done)
+			}()
+			<-started
+			c.Close()
+			<-done
+
+			if ctxErr != context.Canceled {
+				t.Fatalf("Adapter.Ctx().Err() after disconnect = %v; want context.Canceled", ctxErr)
+			}
+			if n := channel.TimeoutOverruns(); n != 0 {
+				t.Fatalf("TimeoutOverruns() = %d after disconnect; want 0", n)
+			}
+		})
+	}
+}
@@ -28,10 +28,33 @@ type (
 		subscriptions map[string]bool
 		readers       *readersMap
 		requests      *requestsMap
+		mws           *middlewareList
 		timeout       time.Duration
 		connected     bool
 		debug         bool
+		options       ClientOptions
+		parent        *Client // parent of namespace client
+		namespace     string
+		namespaces    map[string]*Client
+		nsMutex       sync.RWMutex
+		dedup         *dedupSet // IDs of received reliable messages
 		Reconnect     *events.Event
+
+		// OnPanic is called after recovery of handler panic
+		OnPanic PanicHandler
+		// DisableRecovery turns off handlers panic recovery
+		DisableRecovery bool
+	}
+
+	// ClientOptions of Client instance
+	ClientOptions struct {
+		Debug bool
+		// EnableCompression turns on permessage-deflate negotiation
+		EnableCompression bool
+		// CompressionLevel of permessage-deflate (flate.BestSpeed...flate.BestCompression, 0 is default level)
+		CompressionLevel int
+		// CompressionThreshold is minimal size of compressed messages (smaller messages are sent uncompressed)
+		CompressionThreshold int
 	}
 
 	sndMsg struct {
@@ -46,20 +69,30 @@ func NewClient(url string, debug ...bool) *Client {
 	if len(debug) == 0 {
 		debug = append(debug, false)
 	}
+	return NewClientWithOptions(url, ClientOptions{Debug: debug[0]})
+}
+
+// NewClientWithOptions makes new WC Client with options
+func NewClientWithOptions(url string, options ClientOptions) *Client {
 	ws := &Client{
 		url:       url,
 		requestID: 0,
 		dialer: &websocket.Dialer{
-			Proxy:            http.ProxyFromEnvironment,
-			HandshakeTimeout: time.Second,
+			Proxy:             http.ProxyFromEnvironment,
+			HandshakeTimeout:  time.Second,
+			EnableCompression: options.EnableCompression,
 		},
 		send:          make(chan *sndMsg, 100000),
 		subLock:       sync.RWMutex{},
 		subscriptions: map[string]bool{},
 		readers:       newReaderMap(),
 		requests:      newRequestsMap(),
+		mws:           newMiddlewareList(),
+		namespaces:    map[string]*Client{},
+		dedup:         newDedupSet(),
 		timeout:       time.Second * 30,
-		debug:         debug[0],
+		debug:         options.Debug,
+		options:       options,
 		Reconnect:     events.New(),
 		chBreak:       make(chan bool, 2),
 	}
@@ -71,14 +104,14 @@ func NewClient(url string, debug ...bool) *Client {
 // Request information from server
 func (c *Client) Request(command string, message interface{}, timeout ...time.Duration) ([]byte, error) {
 	requestID := atomic.AddInt64(&c.requestID, 1)
-	resultCh := make(chan []byte)
+	resultCh := make(chan *Adapter, 1)
 	timeoutD := c.timeout
 
 	if len(timeout) > 0 {
 		timeoutD = timeout[0]
 	}
 	c.requests.Set(requestID, func(a *Adapter) {
-		resultCh <- a.Data()
+		resultCh <- a
 	})
 	if err := c.Send(command, message, requestID); err != nil {
 		c.requests.Delete(requestID)
@@ -86,8 +119,8 @@ func (c *Client) Request(command string, message interface{}, timeout ...time.Du
 	}
 
 	select {
-	case result := <-resultCh:
-		return result, nil
+	case a := <-resultCh:
+		return a.reply()
 	case <-time.After(timeoutD):
 		c.requests.Delete(requestID)
 		return []byte{}, fmt.Errorf("\"%s\" request timeout", command)
@@ -96,6 +129,9 @@ func (c *Client) Request(command string, message interface{}, timeout ...time.Du
 
 // Send message to server
 func (c *Client) Send(command string, message interface{}, requestID ...int64) (err error) {
+	if c.parent != nil {
+		return c.parent.Send(c.namespace+namespaceSeparator+command, message, requestID...)
+	}
 	go func() {
 		var reqID int64
 		if len(requestID) > 0 {
@@ -104,8 +140,8 @@ func (c *Client) Send(command string, message interface{}, requestID ...int64) (
 
 		bytesMessage, ok := message.([]byte)
 		if !ok {
-			bytesMessage, err = json.Marshal(message)
-			if err != nil {
+			var err error
+			if bytesMessage, err = json.Marshal(message); err != nil {
 				return
 			}
 		}
@@ -119,19 +155,61 @@ func (c *Client) Send(command string, message interface{}, requestID ...int64) (
 	return nil
 }
 
-// Read is client message (request) handler
-func (c *Client) Read(command string, fn func(*Adapter)) {
-	c.readers.Set(command, fn)
+// Read is client message (request) handler.
+// Command can be pattern with parameters and wildcard: "orders/:id/update", "files/*path" (see Adapter.Param)
+// It returns function which removes the handler.
+func (c *Client) Read(command string, fn func(*Adapter), middlewares ...Middleware) (off func()) {
+	return c.readers.handle(command, chain(fn, middlewares))
+}
+
+// Off removes all handlers of command (or pattern)
+func (c *Client) Off(command string) {
+	c.readers.Delete(command)
+}
+
+// NotFound sets handler of server messages with unknown commands
+// (by default server requests with unknown commands get ErrCodeNotFound error reply)
+func (c *Client) NotFound(fn func(*Adapter), middlewares ...Middleware) {
+	c.readers.Delete(notFoundCommand)
+	c.readers.Set(notFoundCommand, chain(fn, middlewares))
+}
+
+// Use adds middlewares for all client handlers
+func (c *Client) Use(middlewares ...Middleware) {
+	c.mws.Add(middlewares...)
+}
+
+// Group creates group of commands with common prefix and middlewares
+func (c *Client) Group(prefix string, middlewares ...Middleware) *Group {
+	return newGroup(c, prefix, middlewares)
+}
+
+// dispatch runs command handlers wrapped with client middlewares
+func (c *Client) dispatch(adapter *Adapter, fns []Handler) {
+	if !c.DisableRecovery {
+		defer func() {
+			if rec := recover(); rec != nil {
+				recoverHandler(adapter, rec, c.OnPanic)
+			}
+		}()
+	}
+	c.mws.Wrap(func(a *Adapter) {
+		for _, fn := range fns {
+			fn(a)
+		}
+	})(adapter)
 }
 
 // ChangeURL for client connection
 func (c *Client) ChangeURL(url string) {
+	c = c.root()
 	c.url = url
 	c.chBreak <- true
 }
 
 // Close client connection
 func (c *Client) Close() {
+	c = c.root()
 	c.url = ""
 	c.chBreak <- true
 }
@@ -150,6 +228,9 @@ func (c *Client) connect() {
 				return false
 			}
 
+			if c.options.CompressionLevel != 0 {
+				c.conn.SetCompressionLevel(c.options.CompressionLevel)
+			}
 			if c.debug {
 				fmt.Printf("ws.Client: + Connected to %s\n", c.url)
 			}
@@ -160,23 +241,16 @@ func (c *Client) connect() {
 				for {
 					select {
 					case msg := <-c.send:
-						c.conn.WriteMessage(websocket.TextMessage, append([]byte(conv.String(msg.requestID)+":"+msg.command+":"), msg.data...))
+						data := append([]byte(conv.String(msg.requestID)+":"+msg.command+":"), msg.data...)
+						c.conn.EnableWriteCompression(len(data) >= c.options.CompressionThreshold)
+						c.conn.WriteMessage(websocket.TextMessage, data)
 					case <-closed:
 						return
 					}
 				}
 			}()
 
-			cmds := []string{}
-			c.subLock.RLock()
-			for command := range c.subscriptions {
-				cmds = append(cmds, command)
-			}
-			c.subLock.RUnlock()
-
-			for _, command := range cmds {
-				c.Send("subscribe", command)
-			}
+			c.resubscribe()
 
 		cycle:
 			for {
@@ -193,22 +267,7 @@ func (c *Client) connect() {
 				case message := <-chMessage:
 					result := bytes.SplitN(message, []byte(":"), 3)
 					if len(result) == 3 {
-						requestID := conv.Int64(result[0])
-						command := string(result[1])
-						data := result[2]
-
-						if requestID > 0 { // answer to the request from client
-							if fn, ex := c.requests.GetEx(requestID); ex {
-								fn(newAdapter(command, nil, &data, requestID))
-								c.requests.Delete(requestID)
-							}
-						} else if fns, exists := c.readers.GetEx(command); exists {
-							adapter := newAdapter(command, nil, &data, requestID)
-							adapter.client = c
-							for _, fn := range fns {
-								fn(adapter)
-							}
-						}
+						c.process(conv.Int64(result[0]), string(result[1]), result[2])
 					}
 				case <-c.chBreak:
 					if c.url == "" {
@@ -235,9 +294,44 @@ func (c *Client) connect() {
 	}
 }
 
+// process routes server message to namespace, request callback or command handlers and reports whether any of them ran
+func (c *Client) process(requestID int64, command string, data []byte) (handled bool) {
+	if name, cmd := splitNamespace(command); name != "" {
+		if ns, ok := c.getNamespace(name); ok {
+			return ns.process(requestID, cmd, data)
+		}
+	}
+
+	if command == reliableCommand {
+		c.receiveReliable(data)
+	} else if requestID > 0 { // answer to the request from client
+		fn, ex := c.requests.GetEx(requestID)
+		if !ex {
+			return false
+		}
+		fn(newAdapter(command, nil, &data, requestID))
+		c.requests.Delete(requestID)
+	} else if fns, params, _, exists := c.readers.Match(command); exists {
+		adapter := newAdapter(command, nil, &data, requestID)
+		adapter.client = c
+		adapter.params = params
+		c.dispatch(adapter, fns)
+	} else {
+		adapter := newAdapter(command, nil, &data, requestID)
+		adapter.client = c
+		fns, exists := c.readers.GetEx(notFoundCommand)
+		if !exists {
+			adapter.SendError(unknownCommand(command))
+			return false
+		}
+		c.dispatch(adapter, fns)
+	}
+	return true
+}
+
 // Subscribe connection to command
 func (c *Client) Subscribe(command string) {
-	if c.connected {
+	if c.isConnected() {
 		c.Send("subscribe", command)
 	}
 	c.subLock.Lock()
@@ -250,8 +344,8 @@ func (c *Client) UnSubscribe(command string) {
 	c.subLock.Lock()
 	delete(c.subscriptions, command)
 	c.subLock.Unlock()
-	if c.connected {
-		c.ChangeURL(c.url)
+	if c.isConnected() {
+		c.ChangeURL(c.root().url)
 	}
 }
 
@@ -1,19 +1,17 @@
 package ws
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"net/http"
+	"net"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
-	"github.com/valyala/fasthttp"
-
-	"github.com/gin-gonic/gin"
 	"github.com/night-codes/conv"
-	"github.com/night-codes/tokay"
 	websocket "github.com/night-codes/tokay-websocket"
 )
 
@@ -21,19 +19,33 @@ type (
 	// Connection instance
 	// [Copying Connection by value is forbidden. Use pointer to Connection instead.]
 	Connection struct {
+		*valuesMap      // connection session values
 		id              uint64
 		user            *User
 		conn            ConnIface
-		closed          bool
+		closed          int32 // 1 if connection is closed (atomic, broadcast workers check it concurrently)
 		subscribes      map[string]bool
 		subscribesMutex sync.RWMutex
+		labels          map[string]bool
+		labelsMutex     sync.RWMutex
 		writeMutex      sync.RWMutex
 		wsClient        bool
 		channel         *Channel
 		context         NetContext
-		requestID       int64
 		timeout         time.Duration
 		origin          string
+		remoteIP        string
+		handshake       *HandshakeInfo
+		claims          Claims
+		authMutex       sync.RWMutex
+		expiry          *time.Timer
+		parent          *Connection // physical connection of namespace connection
+		nsConns         map[string]*Connection
+		nsMutex         sync.Mutex
+		nsLeft          bool
+		ctx             context.Context // cancelled when connection is closed
+		cancel          context.CancelFunc
+		slot            *slot // place in connection limits (guarded by channel slots mutex)
 	}
 
 	// Map is alias for map[string]interface{}
@@ -41,61 +53,100 @@ type (
 )
 
 // NewConnection creates new *Connection instance
-func newConnection(connID uint64, channel *Channel, conn ConnIface, context NetContext) *Connection {
+func newConnection(connID uint64, channel *Channel, conn ConnIface, netContext NetContext, info *HandshakeInfo) *Connection {
 	c := &Connection{
+		valuesMap:  newValuesMap(),
 		id:         connID,
 		channel:    channel,
 		conn:       conn,
-		context:    context,
+		context:    netContext,
 		subscribes: make(map[string]bool),
+		labels:     make(map[string]bool),
 		timeout:    time.Second * 30,
+		nsConns:    map[string]*Connection{},
 	}
-	channel.connMap.Set(connID, c)
+	c.ctx, c.cancel = context.WithCancel(context.WithValue(context.Background(), ContextConnID, connID))
 
-	switch cc := context.(type) {
-	case *tokay.Context:
-		c.origin = cc.GetHeader("Origin")
-		c.wsClient = len(cc.GetHeader("ws-client")) > 0
-		c.setUser(cc.Get("userID"))
-	case *gin.Context:
-		c.origin = cc.Request.Header.Get("Origin")
-		c.wsClient = len(cc.Request.Header.Get("ws-client")) > 0
-		user, _ := cc.Get("userID")
-		c.setUser(user)
-	case *fasthttp.RequestCtx:
-		c.origin = string(cc.Request.Header.Peek("Origin"))
-		c.wsClient = len(string(cc.Request.Header.Peek("ws-client"))) > 0
-		c.setUser(cc.UserValue("userID"))
-	case *http.Request:
-		c.origin = cc.Header.Get("Origin")
-		c.wsClient = len(cc.Header.Get("ws-client")) > 0
-		c.setUser(cc.Context().Value("userID"))
-		// Example:
-		// import "net/http"
-		// import "context"
-		// ...
-		// request.WithContext(context.WithValue(request.Context(), "UserID", 12345))
+	if info == nil {
+		info = contextHandshake(netContext)
+	}
+	if sp, ok := conn.(interface{ Subprotocol() string }); ok {
+		info.Subprotocol = sp.Subprotocol()
+	}
+	if cl, ok := conn.(interface{ SetCompressionLevel(int) error }); ok && channel.CompressionLevel != 0 {
+		cl.SetCompressionLevel(channel.CompressionLevel)
+	}
+	c.handshake = info
+	c.origin = info.Header.Get("Origin")
+	c.wsClient = len(info.Header.Get("ws-client")) > 0
+	c.claims = info.claims
+
+	if addr, ok := conn.(interface{ RemoteAddr() net.Addr }); ok && info.RemoteAddr == "" && addr.RemoteAddr() != nil {
+		info.RemoteAddr = addr.RemoteAddr().String()
+	}
+	if info.RemoteIP == "" {
+		info.RemoteIP = channel.resolveIP(info)
 	}
+	c.remoteIP = info.RemoteIP
+	channel.connMap.Set(connID, c)
+	if c.remoteIP != "" {
+		ipConns, ok := channel.ips.GetEx(c.remoteIP)
+		if !ok {
+			ipConns = newConnMap()
+			channel.ips.Set(c.remoteIP, ipConns)
+		}
+		ipConns.Set(connID, c)
+	}
+
+	c.setUser(info.userID)
+	c.resetExpiry()
 	return c
 }
 
 // NewConnection creates new *Connection instance
 func emptyConnection() *Connection {
-	return &Connection{
-		closed: true,
+	c := &Connection{
+		valuesMap: newValuesMap(),
+		labels:    make(map[string]bool),
+		closed:    1,
 	}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	c.cancel()
+	return c
 }
 
 // User returns connection user
 func (c *Connection) User() *User {
+	c.authMutex.RLock()
+	defer c.authMutex.RUnlock()
 	return c.user
 }
 
+// Handshake returns framework-neutral information about connection handshake request
+func (c *Connection) Handshake() *HandshakeInfo {
+	return c.handshake
+}
+
+// Claims returns connection claims from Authenticator
+func (c *Connection) Claims() Claims {
+	if c.parent != nil {
+		return c.parent.Claims()
+	}
+	c.authMutex.RLock()
+	defer c.authMutex.RUnlock()
+	return c.claims
+}
+
 // Origin of connection
 func (c *Connection) Origin() string {
 	return c.origin
 }
 
+// RemoteIP returns client IP (resolved with forwarding headers of trusted proxies)
+func (c *Connection) RemoteIP() string {
+	return c.remoteIP
+}
+
 // ID of Connection
 func (c *Connection) ID() uint64 {
 	return c.id
@@ -103,15 +154,15 @@ func (c *Connection) ID() uint64 {
 
 // Request information from client
 func (c *Connection) Request(command string, message interface{}, timeout ...time.Duration) ([]byte, error) {
-	requestID := atomic.AddInt64(&c.requestID, -1)
-	resultCh := make(chan []byte)
+	requestID := atomic.AddInt64(&c.channel.requestID, -1)
+	resultCh := make(chan *Adapter, 1)
 	timeoutD := c.timeout
 
 	if len(timeout) > 0 {
 		timeoutD = timeout[0]
 	}
 	c.channel.requests.Set(requestID, func(a *Adapter) {
-		resultCh <- a.Data()
+		resultCh <- a
 	})
 
 	if err := c.Send(command, message, 0, requestID); err != nil {
@@ -120,14 +171,54 @@ func (c *Connection) Request(command string, message interface{}, timeout ...tim
 	}
 
 	select {
-	case result := <-resultCh:
-		return result, nil
+	case a := <-resultCh:
+		return a.reply()
 	case <-time.After(timeoutD):
 		c.channel.requests.Delete(requestID)
 		return []byte{}, fmt.Errorf("\"%s\" request timeout", command)
 	}
 }
 
+// request sends request to client and waits for answer until ctx is done or connection is closed
+// (errors are without connection ID for ConnectionError of RequestAll report)
+func (c *Connection) request(ctx context.Context, command string, message interface{}) ([]byte, error) {
+	if c.channel == nil || c.isClosed() {
+		return []byte{}, ErrConnectionClosed
+	}
+	requestID := atomic.AddInt64(&c.channel.requestID, -1)
+	resultCh := make(chan *Adapter, 1)
+	c.channel.requests.Set(requestID, func(a *Adapter) {
+		resultCh <- a
+	})
+	defer c.channel.requests.Delete(requestID)
+
+	if err := c.Send(command, message, 0, requestID); err != nil {
+		if errors.Is(err, ErrConnectionClosed) {
+			return []byte{}, ErrConnectionClosed
+		}
+		return []byte{}, err
+	}
+
+	select {
+	case a := <-resultCh:
+		return a.reply()
+	case <-c.Ctx().Done():
+		return []byte{}, ErrConnectionClosed
+	case <-ctx.Done():
+		return []byte{}, ctx.Err()
+	}
+}
+
+// isClosed returns true if connection is closed
+func (c *Connection) isClosed() bool {
+	return atomic.LoadInt32(&c.closed) == 1
+}
+
+// Ctx returns context.Context of connection (cancelled when connection is closed)
+func (c *Connection) Ctx() context.Context {
+	return c.ctx
+}
+
 // Context returns copy of NetContext
 func (c *Connection) Context() NetContext {
 	return c.context
@@ -136,7 +227,7 @@ func (c *Connection) Context() NetContext {
 // Subscribers returns Connects Subscribers of commands ("command1,command2" etc.)
 func (c *Connection) Subscribers(commands string) Connections {
 	conns := newConnections()
-	if !c.closed && c.IsSubscribed(commands) {
+	if !c.isClosed() && c.IsSubscribed(commands) {
 		conns.Add(c)
 	}
 	return conns
@@ -144,7 +235,7 @@ func (c *Connection) Subscribers(commands string) Connections {
 
 // IsSubscribed returns true if Connect subscribed for one of commands ("command1,command2" etc.)
 func (c *Connection) IsSubscribed(commands string) bool {
-	if !c.closed {
+	if !c.isClosed() {
 		c.subscribesMutex.RLock()
 		defer c.subscribesMutex.RUnlock()
 
@@ -157,40 +248,161 @@ func (c *Connection) IsSubscribed(commands string) bool {
 	return false
 }
 
+// AddLabel marks connection with labels (for Channel.ByLabel selections)
+func (c *Connection) AddLabel(labels ...string) {
+	c.labelsMutex.Lock()
+	for _, label := range labels {
+		c.labels[label] = true
+	}
+	c.labelsMutex.Unlock()
+}
+
+// RemoveLabel removes connection labels
+func (c *Connection) RemoveLabel(labels ...string) {
+	c.labelsMutex.Lock()
+	for _, label := range labels {
+		delete(c.labels, label)
+	}
+	c.labelsMutex.Unlock()
+}
+
+// HasLabel returns true if connection has one of labels
+func (c *Connection) HasLabel(labels ...string) bool {
+	c.labelsMutex.RLock()
+	defer c.labelsMutex.RUnlock()
+	for _, label := range labels {
+		if c.labels[label] {
+			return true
+		}
+	}
+	return false
+}
+
+// Labels of connection
+func (c *Connection) Labels() []string {
+	c.labelsMutex.RLock()
+	defer c.labelsMutex.RUnlock()
+	ret := make([]string, 0, len(c.labels))
+	for label := range c.labels {
+		ret = append(ret, label)
+	}
+	return ret
+}
+
 // Close connect
 func (c *Connection) Close() {
-	if !c.closed {
-		c.closed = true
+	if atomic.CompareAndSwapInt32(&c.closed, 0, 1) {
+		c.cancel()
+		c.leaveNamespaces()
 		c.conn.Close()
 
 		c.writeMutex.Lock()
 		c.conn.WriteMessage(websocket.CloseMessage, nil)
 		c.writeMutex.Unlock()
 
-		c.user.connMap.Delete(c.ID())
+		user := c.User()
+		user.connMap.Delete(c.ID())
 		c.channel.connMap.Delete(c.ID())
-		if c.user.connMap.Len() == 0 {
-			c.channel.users.Delete(c.user.ID())
+		lastOfUser := user.connMap.Len() == 0
+		if lastOfUser {
+			c.channel.users.Delete(user.ID())
+		}
+
+		lastOfIP := false
+		if ipConns, ok := c.channel.ips.GetEx(c.remoteIP); ok {
+			ipConns.Delete(c.ID())
+			if lastOfIP = ipConns.Len() == 0; lastOfIP {
+				c.channel.ips.Delete(c.remoteIP)
+			}
 		}
+		c.channel.limiter.Forget(c, lastOfUser, lastOfIP)
+		c.channel.release(c)
+
+		c.authMutex.Lock()
+		if c.expiry != nil {
+			c.expiry.Stop()
+		}
+		c.authMutex.Unlock()
+
+		if c.parent != nil {
+			c.leaveParent()
+		}
+	}
+}
+
+// CloseWithReason sends close frame with code and reason text and closes connection
+func (c *Connection) CloseWithReason(code int, reason string) {
+	if !c.isClosed() {
+		c.writeMutex.Lock()
+		c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason))
+		c.writeMutex.Unlock()
+		c.Close()
+	}
+}
+
+// SetUser rebinds connection to the user with userID
+// (returns ErrTooManyUserConnections if the user has Channel.MaxConnectionsPerUser connections)
+func (c *Connection) SetUser(userID interface{}) error {
+	prev := c.User()
+	if c.isClosed() || prev == nil || prev.ID() == userID {
+		return nil
+	}
+	if !c.channel.moveSlot(c, userID) {
+		return ErrTooManyUserConnections
+	}
+	c.setUser(userID)
+	prev.connMap.Delete(c.ID())
+	if prev.connMap.Len() == 0 {
+		c.channel.users.Delete(prev.ID())
+		c.channel.limiter.ForgetUser(prev.ID())
+	}
+
+	c.nsMutex.Lock()
+	nsConns := make([]*Connection, 0, len(c.nsConns))
+	for _, nc := range c.nsConns {
+		nsConns = append(nsConns, nc)
+	}
+	c.nsMutex.Unlock()
+	for _, nc := range nsConns {
+		nc.SetUser(userID) // namespace connections have no slots in connection limits
+	}
+	go c.channel.reliable.resend(c)
+	return nil
+}
+
+// resetExpiry closes connection when its credentials ("exp" claim) expire
+func (c *Connection) resetExpiry() {
+	c.authMutex.Lock()
+	defer c.authMutex.Unlock()
+	if c.expiry != nil {
+		c.expiry.Stop()
+		c.expiry = nil
+	}
+	if exp := c.claims.ExpiresAt(); !exp.IsZero() {
+		c.expiry = time.AfterFunc(time.Until(exp), func() {
+			c.CloseWithReason(websocket.ClosePolicyViolation, "credentials expired")
+		})
 	}
 }
 
 func (c *Connection) setUser(userID interface{}) {
-	if !c.closed {
+	if !c.isClosed() {
 		user, ok := c.channel.users.GetEx(userID)
 		if !ok {
-			user = newUser(userID)
+			user = newUser(userID, c.channel)
 			c.channel.users.Set(userID, user)
 		}
 
 		user.connMap.Set(c.ID(), c)
+		c.authMutex.Lock()
 		c.user = user
+		c.authMutex.Unlock()
 	}
 }
 
 // Subscribe connection to command
 func (c *Connection) Subscribe(command string) {
-	if !c.closed {
+	if !c.isClosed() {
 		subscribes, ok := c.channel.subscrs.GetEx(command)
 		if !ok {
 			subscribes = newConnMap()
@@ -206,8 +418,8 @@ func (c *Connection) Subscribe(command string) {
 
 // Send message to open connect
 func (c *Connection) Send(command string, message interface{}, requestID ...int64) error {
-	if c.closed {
-		return fmt.Errorf("Connection %d already clossed", c.ID())
+	if c.isClosed() {
+		return fmt.Errorf("Connection %d: %w", c.ID(), ErrConnectionClosed)
 	}
 
 	if message != nil {
@@ -220,48 +432,90 @@ func (c *Connection) Send(command string, message interface{}, requestID ...int6
 			}
 		}
 
-		msg := &[]byte{}
-		var err error
-
-		if c.wsClient {
-			if m, ok := message.([]byte); ok {
-				msg = &m
-			} else if m, ok := message.(*[]byte); ok {
-				msg = m
-			} else {
-				var m []byte
-				m, err = json.Marshal(message)
-				msg = &m
-			}
+		msg, err := encodeMessage(c.wsClient, c.Namespace(), command, message, reqID, srvReqID)
+		if err != nil {
+			return fmt.Errorf("WS: Connection.Send: json.Marshal: %v", err)
+		}
+		return c.write(msg)
+	}
+	return nil
+}
 
-			strRequestID := conv.String(reqID)
-			if srvReqID != 0 {
-				strRequestID = conv.String(srvReqID)
-			}
-			*msg = append([]byte(strRequestID+":"+command+":"), *msg...)
-		} else {
-			var m []byte
-			m, err = json.Marshal(Map{
-				"command":      command,
-				"requestID":    reqID,
-				"srvRequestID": srvReqID,
-				"data":         message,
-			})
-			msg = &m
+// encodeMessage makes "requestID:namespace|command:data" message for ws.Client or JSON message for js client
+func encodeMessage(wsClient bool, namespace, command string, message interface{}, reqID, srvReqID int64) ([]byte, error) {
+	if !wsClient {
+		msg := Map{
+			"command":      command,
+			"requestID":    reqID,
+			"srvRequestID": srvReqID,
+			"data":         message,
+		}
+		if namespace != "" {
+			msg["namespace"] = namespace
 		}
+		return json.Marshal(msg)
+	}
+	if namespace != "" {
+		command = namespace + namespaceSeparator + command
+	}
 
-		if err != nil {
-			return fmt.Errorf("WS: Connection.Send: json.Marshal: %v", err)
+	var data []byte
+	switch m := message.(type) {
+	case []byte:
+		data = m
+	case *[]byte:
+		data = *m
+	default:
+		var err error
+		if data, err = json.Marshal(message); err != nil {
+			return nil, err
 		}
+	}
 
-		wstype := websocket.TextMessage
-		if c.channel.UseBinary {
-			wstype = websocket.BinaryMessage
+	strRequestID := conv.String(reqID)
+	if srvReqID != 0 {
+		strRequestID = conv.String(srvReqID)
+	}
+	return append([]byte(strRequestID+":"+command+":"), data...), nil
+}
+
+// sendError replies to the client request with error
+func (c *Connection) sendError(command string, requestID int64, e *Error) error {
+	if c.isClosed() {
+		return fmt.Errorf("Connection %d: %w", c.ID(), ErrConnectionClosed)
+	}
+	if c.wsClient {
+		errCommand := errorCommand
+		if i := strings.LastIndex(command, namespaceSeparator); i > 0 { // command of unknown namespace
+			errCommand = command[:i+len(namespaceSeparator)] + errorCommand
 		}
+		return c.Send(errCommand, e, requestID)
+	}
 
-		c.writeMutex.Lock()
-		c.conn.WriteMessage(wstype, *msg)
-		c.writeMutex.Unlock()
+	m := Map{
+		"command":   command,
+		"requestID": requestID,
+		"error":     e,
 	}
-	return nil
+	if ns := c.Namespace(); ns != "" {
+		m["namespace"] = ns
+	}
+	msg, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("WS: Connection.sendError: json.Marshal: %v", err)
+	}
+	return c.write(msg)
+}
+
+func (c *Connection) write(msg []byte) error {
+	return c.writeMessage(c.channel.messageType(), msg)
+}
+
+func (c *Connection) writeMessage(messageType int, msg []byte) error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	if cw, ok := c.conn.(interface{ EnableWriteCompression(bool) }); ok {
+		cw.EnableWriteCompression(len(msg) >= c.channel.CompressionThreshold)
+	}
+	return c.conn.WriteMessage(messageType, msg)
 }
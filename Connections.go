@@ -1,9 +1,6 @@
 package ws
 
-import (
-	"errors"
-	"fmt"
-)
+import "context"
 
 // Connections is slice of Connect instances
 type Connections struct {
@@ -14,18 +11,20 @@ func newConnections() Connections {
 	return Connections{connMap: newConnMap()}
 }
 
-// Send message to open connect
+// Send message to open connect (returns *BroadcastError if some of them failed)
 func (cs Connections) Send(command string, message interface{}) error {
-	errStr := ""
-	for _, connect := range cs.connMap.Copy() {
-		if err := connect.Send(command, message); err != nil {
-			errStr += fmt.Sprintf("Connect %d: %v/n", connect.ID(), err)
-		}
-	}
-	if errStr != "" {
-		return errors.New(errStr)
-	}
-	return nil
+	return cs.SendReport(command, message).Err()
+}
+
+// SendReport sends message to open connections and returns delivery report
+func (cs Connections) SendReport(command string, message interface{}) DeliveryReport {
+	return broadcast(cs.connMap.Copy(), command, message)
+}
+
+// SendWithAck sends message to connections in parallel and waits for acknowledgements (see Connection.SendWithAck).
+// Report has errors of connections which didn't acknowledge message before ctx is done.
+func (cs Connections) SendWithAck(ctx context.Context, command string, message interface{}) DeliveryReport {
+	return sendWithAck(ctx, cs.connMap.Copy(), command, message)
 }
 
 // Add connection to list
@@ -59,3 +58,83 @@ func (cs Connections) Subscribers(commands string) Connections {
 	}
 	return ret
 }
+
+// Len returns count of connections
+func (cs Connections) Len() int {
+	return cs.connMap.Len()
+}
+
+// Each calls fn for each connection
+func (cs Connections) Each(fn func(*Connection)) {
+	for _, connection := range cs.connMap.Copy() {
+		fn(connection)
+	}
+}
+
+// Filter returns connections for which fn returns true
+func (cs Connections) Filter(fn func(*Connection) bool) Connections {
+	ret := newConnections()
+	for _, connection := range cs.connMap.Copy() {
+		if fn(connection) {
+			ret.Add(connection)
+		}
+	}
+	return ret
+}
+
+// Except returns connections without conns (e.g. everyone except the sender)
+func (cs Connections) Except(conns ...*Connection) Connections {
+	ret := newConnections()
+	for id, connection := range cs.connMap.Copy() {
+		ret.connMap.connects[id] = connection
+	}
+	for _, connection := range conns {
+		delete(ret.connMap.connects, connection.ID())
+	}
+	return ret
+}
+
+// Union returns connections of all lists
+func (cs Connections) Union(others ...Connections) Connections {
+	ret := newConnections()
+	for _, list := range append([]Connections{cs}, others...) {
+		for id, connection := range list.connMap.Copy() {
+			ret.connMap.connects[id] = connection
+		}
+	}
+	return ret
+}
+
+// Intersect returns connections which are in all lists
+func (cs Connections) Intersect(others ...Connections) Connections {
+	return cs.Filter(func(connection *Connection) bool {
+		for _, list := range others {
+			if _, ok := list.connMap.GetEx(connection.ID()); !ok {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// ByUser returns connections of user
+func (cs Connections) ByUser(userID interface{}) Connections {
+	return cs.Filter(func(connection *Connection) bool {
+		user := connection.User()
+		return user != nil && user.ID() == userID
+	})
+}
+
+// ByOrigin returns connections with origin
+func (cs Connections) ByOrigin(origin string) Connections {
+	return cs.Filter(func(connection *Connection) bool {
+		return connection.Origin() == origin
+	})
+}
+
+// ByLabel returns connections with one of labels
+func (cs Connections) ByLabel(labels ...string) Connections {
+	return cs.Filter(func(connection *Connection) bool {
+		return connection.HasLabel(labels...)
+	})
+}
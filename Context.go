@@ -0,0 +1,83 @@
+package ws
+
+import "context"
+
+type (
+	// ContextKey is key of values in connection and message contexts
+	ContextKey string
+
+	// messageContext is per-message context with connection ID, user ID, command and request ID values
+	messageContext struct {
+		context.Context
+		adapter *Adapter
+		userID  interface{}
+	}
+
+	adapterKey struct{}
+)
+
+// Keys of Adapter.Ctx() values (ContextConnID is also set in Connection.Ctx())
+const (
+	ContextConnID    ContextKey = "ws.connID"    // uint64
+	ContextUserID    ContextKey = "ws.userID"    // interface{}
+	ContextCommand   ContextKey = "ws.command"   // string
+	ContextRequestID ContextKey = "ws.requestID" // int64
+)
+
+// newMessageContext makes context of message handling derived from connection context
+func newMessageContext(a *Adapter) context.Context {
+	ctx := &messageContext{
+		Context: context.Background(),
+		adapter: a,
+	}
+	if c := a.connection; c != nil && c.ctx != nil {
+		ctx.Context = c.ctx
+		if user := c.User(); user != nil {
+			ctx.userID = user.ID()
+		}
+	}
+	return ctx
+}
+
+func (c *messageContext) Value(key interface{}) interface{} {
+	switch key {
+	case ContextUserID:
+		return c.userID
+	case ContextCommand:
+		return c.adapter.command
+	case ContextRequestID:
+		return c.adapter.requestID
+	case adapterKey{}:
+		return c.adapter
+	}
+	return c.Context.Value(key)
+}
+
+// AdapterFromContext returns Adapter of message context (nil if ctx isn't derived from Adapter.Ctx())
+func AdapterFromContext(ctx context.Context) *Adapter {
+	a, _ := ctx.Value(adapterKey{}).(*Adapter)
+	return a
+}
+
+// ConnIDFromContext returns connection ID of context
+func ConnIDFromContext(ctx context.Context) (uint64, bool) {
+	connID, ok := ctx.Value(ContextConnID).(uint64)
+	return connID, ok
+}
+
+// UserIDFromContext returns user ID of message context
+func UserIDFromContext(ctx context.Context) interface{} {
+	return ctx.Value(ContextUserID)
+}
+
+// CommandFromContext returns command of message context
+func CommandFromContext(ctx context.Context) (string, bool) {
+	command, ok := ctx.Value(ContextCommand).(string)
+	return command, ok
+}
+
+// RequestIDFromContext returns request ID of message context (0 if message isn't request)
+func RequestIDFromContext(ctx context.Context) (int64, bool) {
+	requestID, ok := ctx.Value(ContextRequestID).(int64)
+	return requestID, ok
+}
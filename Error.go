@@ -0,0 +1,77 @@
+package ws
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"runtime/debug"
+)
+
+type (
+	// Error is error reply to the request
+	Error struct {
+		Code    int         `json:"code"`
+		Message string      `json:"message"`
+		Details interface{} `json:"details,omitempty"`
+	}
+
+	// PanicHandler is called after handler panic recovery
+	PanicHandler func(a *Adapter, err interface{}, stack []byte)
+)
+
+// Error codes of replies
+const (
+	ErrCodeBadRequest   = 400
+	ErrCodeUnauthorized = 401
+	ErrCodeForbidden    = 403
+	ErrCodeNotFound     = 404
+	ErrCodeValidation   = 422 // details are []FieldError
+	ErrCodeRateLimit    = 429
+	ErrCodeInternal     = 500
+	ErrCodeTimeout      = 504
+)
+
+const (
+	// errorCommand is reserved command of error replies for ws.Client
+	errorCommand = "ws-error"
+	// notFoundCommand is reserved command of unknown commands handler
+	notFoundCommand = "ws-not-found"
+)
+
+// NewError makes new *Error instance
+func NewError(code int, message string, details ...interface{}) *Error {
+	e := &Error{Code: code, Message: message}
+	if len(details) > 0 {
+		e.Details = details[0]
+	}
+	return e
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s (code %d)", e.Message, e.Code)
+}
+
+// toError converts any error to *Error
+func toError(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	return &Error{Code: ErrCodeInternal, Message: err.Error()}
+}
+
+// unknownCommand is default error reply to requests with unknown commands
+func unknownCommand(command string) *Error {
+	return NewError(ErrCodeNotFound, fmt.Sprintf("unknown command %q", command))
+}
+
+// recoverHandler logs recovered panic, replies to the request and calls onPanic hook
+func recoverHandler(a *Adapter, rec interface{}, onPanic PanicHandler) {
+	stack := debug.Stack()
+	log.Printf("ws: panic in \"%s\" handler: %v\n%s", a.command, rec, stack)
+	a.SendError(NewError(ErrCodeInternal, "internal error")) // no-op if answer was sent or it isn't request
+
+	if onPanic != nil {
+		onPanic(a, rec, stack)
+	}
+}
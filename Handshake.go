@@ -0,0 +1,200 @@
+package ws
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/night-codes/conv"
+	"github.com/night-codes/tokay"
+	"github.com/valyala/fasthttp"
+)
+
+// authCommand is reserved command of auth token refresh
+const authCommand = "ws-auth"
+
+type (
+	// HandshakeInfo is framework-neutral information about WebSocket handshake request (captured once before upgrade)
+	HandshakeInfo struct {
+		Header      http.Header
+		Cookies     []*http.Cookie
+		Query       url.Values
+		Host        string
+		Path        string
+		RemoteAddr  string
+		RemoteIP    string               // client IP resolved with trusted proxies headers
+		TLS         *tls.ConnectionState // nil for plain connections
+		Subprotocol string               // chosen subprotocol (set after upgrade)
+		Token       string               // fresh token of built-in "ws-auth" command (empty on handshake)
+
+		userID interface{}
+		claims Claims
+	}
+
+	// Claims of authenticated connection
+	Claims map[string]interface{}
+
+	// Authenticator checks handshake request and returns connection user ID and claims.
+	// Returned error turns into 401 response (403 if it is ErrForbidden).
+	// It is also called by built-in "ws-auth" command with handshake info of connection and fresh token
+	// in Token field (and "Authorization: Bearer" header): Query and Cookies are still of the handshake.
+	// Connection is closed when its "exp" claim expires without refresh.
+	Authenticator func(info *HandshakeInfo) (userID interface{}, claims Claims, err error)
+)
+
+// Authentication errors
+var (
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+)
+
+// ExpiresAt returns credentials expiration time from "exp" claim (zero time if it is not set)
+func (c Claims) ExpiresAt() time.Time {
+	switch exp := c["exp"].(type) {
+	case nil:
+		return time.Time{}
+	case time.Time:
+		return exp
+	default:
+		if sec := conv.Int64(exp); sec > 0 {
+			return time.Unix(sec, 0)
+		}
+	}
+	return time.Time{}
+}
+
+// NewHandshakeInfo makes *HandshakeInfo from "net/http".Request
+func NewHandshakeInfo(r *http.Request) *HandshakeInfo {
+	return &HandshakeInfo{
+		Header:     r.Header.Clone(),
+		Cookies:    r.Cookies(),
+		Query:      r.URL.Query(),
+		Host:       r.Host,
+		Path:       r.URL.Path,
+		RemoteAddr: r.RemoteAddr,
+		TLS:        r.TLS,
+	}
+}
+
+// NewFastHandshakeInfo makes *HandshakeInfo from "github.com/valyala/fasthttp".RequestCtx
+func NewFastHandshakeInfo(ctx *fasthttp.RequestCtx) *HandshakeInfo {
+	info := &HandshakeInfo{
+		Header:     http.Header{},
+		Query:      url.Values{},
+		Host:       string(ctx.Host()),
+		Path:       string(ctx.Path()),
+		RemoteAddr: ctx.RemoteAddr().String(),
+		TLS:        ctx.TLSConnectionState(),
+	}
+	ctx.Request.Header.VisitAll(func(key, value []byte) {
+		info.Header.Add(string(key), string(value))
+	})
+	ctx.QueryArgs().VisitAll(func(key, value []byte) {
+		info.Query.Add(string(key), string(value))
+	})
+	info.Cookies = (&http.Request{Header: info.Header}).Cookies()
+	return info
+}
+
+// contextHandshake makes *HandshakeInfo from connectors NetContext (for Channel.Handler calls without info)
+func contextHandshake(context NetContext) *HandshakeInfo {
+	var info *HandshakeInfo
+	switch cc := context.(type) {
+	case *HandshakeInfo:
+		info = cc
+	case *tokay.Context:
+		info = NewFastHandshakeInfo(cc.RequestCtx)
+		info.userID = cc.Get("userID")
+	case *gin.Context:
+		info = NewHandshakeInfo(cc.Request)
+		info.userID, _ = cc.Get("userID")
+	case *fasthttp.RequestCtx:
+		info = NewFastHandshakeInfo(cc)
+		info.userID = cc.UserValue("userID")
+	case *http.Request:
+		info = NewHandshakeInfo(cc)
+		info.userID = cc.Context().Value("userID")
+		// Example:
+		// import "net/http"
+		// import "context"
+		// ...
+		// request.WithContext(context.WithValue(request.Context(), "UserID", 12345))
+	default:
+		info = &HandshakeInfo{Header: http.Header{}, Query: url.Values{}}
+	}
+	return info
+}
+
+// SetAuthenticator sets handshake Authenticator of channel
+func (channel *Channel) SetAuthenticator(auth Authenticator) {
+	channel.authenticator = auth
+}
+
+// Prepare authenticates handshake and checks connection limits before upgrade.
+// userID is used if channel has no Authenticator.
+func (channel *Channel) Prepare(info *HandshakeInfo, userID interface{}) *UpgradeError {
+	info.userID = userID
+	if channel.authenticator != nil {
+		userID, claims, err := channel.authenticator(info)
+		if err != nil {
+			if errors.Is(err, ErrForbidden) {
+				return &UpgradeError{Status: http.StatusForbidden, Message: err.Error()}
+			}
+			return &UpgradeError{Status: http.StatusUnauthorized, Message: err.Error()}
+		}
+		info.userID = userID
+		info.claims = claims
+	}
+	info.RemoteIP = channel.resolveIP(info)
+	return channel.Admit(info.userID, info.RemoteIP)
+}
+
+// authReader handles built-in "ws-auth" command: client presents fresh token
+// ("Authorization: Bearer <token>" header for Authenticator) and connection is rebound to its user
+func (channel *Channel) authReader() {
+	channel.Read(authCommand, func(a *Adapter) {
+		c := a.Connection()
+		for c.parent != nil { // namespace connection is authenticated with its physical connection
+			c = c.parent
+		}
+		authenticator := channel.root().authenticator
+		if authenticator == nil {
+			a.SendError(NewError(ErrCodeUnauthorized, "authentication is not supported"))
+			return
+		}
+
+		info := &HandshakeInfo{}
+		if c.handshake != nil {
+			*info = *c.handshake
+		}
+		info.Header = info.Header.Clone()
+		if info.Header == nil {
+			info.Header = http.Header{}
+		}
+		info.Token = a.StringData()
+		info.Header.Set("Authorization", "Bearer "+info.Token)
+
+		userID, claims, err := authenticator(info)
+		if err != nil {
+			if errors.Is(err, ErrForbidden) {
+				a.SendError(NewError(ErrCodeForbidden, err.Error()))
+				return
+			}
+			a.SendError(NewError(ErrCodeUnauthorized, err.Error()))
+			return
+		}
+
+		if err := c.SetUser(userID); err != nil {
+			a.SendError(NewError(ErrCodeRateLimit, err.Error()))
+			return
+		}
+		c.authMutex.Lock()
+		c.claims = claims
+		c.authMutex.Unlock()
+		c.resetExpiry()
+		a.Send(true)
+	})
+}
@@ -0,0 +1,83 @@
+package ws
+
+import "sync"
+
+type (
+	// Handler is Adapter-based message handler
+	Handler func(*Adapter)
+
+	// Middleware wraps Handler with common logic (auth, metrics, recovery, validation etc.)
+	Middleware func(next Handler) Handler
+
+	// Group of commands with common middlewares
+	Group struct {
+		reader      Reader
+		prefix      string
+		middlewares *middlewareList
+	}
+
+	// Reader is implemented by Channel, Client and Group
+	Reader interface {
+		Read(command string, fn func(*Adapter), middlewares ...Middleware) (off func())
+	}
+
+	middlewareList struct {
+		sync.RWMutex
+		list []Middleware
+	}
+)
+
+func newMiddlewareList() *middlewareList {
+	return &middlewareList{}
+}
+
+func (m *middlewareList) Add(mws ...Middleware) {
+	m.Lock()
+	m.list = append(m.list, mws...)
+	m.Unlock()
+}
+
+// Wrap handler with all middlewares of list (first added is outermost)
+func (m *middlewareList) Wrap(h Handler) Handler {
+	m.RLock()
+	list := m.list
+	m.RUnlock()
+	return chain(h, list)
+}
+
+// chain wraps handler with middlewares (first middleware is outermost)
+func chain(h Handler, mws []Middleware) Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
+func newGroup(r Reader, prefix string, mws []Middleware) *Group {
+	g := &Group{
+		reader:      r,
+		prefix:      prefix,
+		middlewares: newMiddlewareList(),
+	}
+	g.middlewares.Add(mws...)
+	return g
+}
+
+// Use adds middlewares to group
+func (g *Group) Use(mws ...Middleware) {
+	g.middlewares.Add(mws...)
+}
+
+// Read is client message (request) handler with group prefix and middlewares
+// (returns function which removes the handler)
+func (g *Group) Read(command string, fn func(*Adapter), middlewares ...Middleware) (off func()) {
+	h := chain(fn, middlewares)
+	return g.reader.Read(g.prefix+command, func(a *Adapter) {
+		g.middlewares.Wrap(h)(a)
+	})
+}
+
+// Group creates subgroup with common prefix and middlewares
+func (g *Group) Group(prefix string, mws ...Middleware) *Group {
+	return newGroup(g, prefix, mws)
+}
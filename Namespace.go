@@ -0,0 +1,286 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	websocket "github.com/night-codes/tokay-websocket"
+)
+
+const (
+	// namespaceSeparator divides namespace and command ("chat|message")
+	namespaceSeparator = "|"
+	// namespaceJoin is command sent by clients to join namespace (on connect and reconnects)
+	namespaceJoin = "ws-join"
+)
+
+// nsConn writes namespace messages to the physical connection
+type nsConn struct {
+	parent *Connection
+}
+
+var errNamespaceRead = errors.New("namespace connection can't be read directly")
+
+func (n nsConn) SetReadLimit(limit int64) {}
+
+func (n nsConn) ReadMessage() (messageType int, p []byte, err error) {
+	return 0, nil, errNamespaceRead
+}
+
+// WriteMessage writes message to the physical connection (close frames are ignored: leaving namespace doesn't close socket)
+func (n nsConn) WriteMessage(messageType int, data []byte) error {
+	if messageType == websocket.CloseMessage {
+		return nil
+	}
+	return n.parent.writeMessage(messageType, data)
+}
+
+func (n nsConn) Close() error {
+	return nil
+}
+
+// splitNamespace returns namespace and command of "namespace|command" (empty namespace if there is no separator)
+func splitNamespace(command string) (namespace, cmd string) {
+	if i := strings.Index(command, namespaceSeparator); i > 0 {
+		return command[:i], command[i+len(namespaceSeparator):]
+	}
+	return "", command
+}
+
+// Namespace returns logical channel multiplexed over connections of this channel (creates it on first call).
+// Namespace has own handlers, middlewares, subscriptions and connect/disconnect hooks;
+// connection joins namespace with first message addressed to it. Middlewares of parent channels
+// run before namespace ones, and OnPanic, DisableRecovery, HandlerTimeout and BroadcastConcurrency
+// of parent are used unless namespace sets its own.
+func (channel *Channel) Namespace(name string) *Channel {
+	channel.nsMutex.Lock()
+	defer channel.nsMutex.Unlock()
+	if ns, ok := channel.namespaces[name]; ok {
+		return ns
+	}
+
+	ns := NewChannel()
+	ns.parent = channel
+	ns.namespace = name
+	if channel.namespace != "" {
+		ns.namespace = channel.namespace + namespaceSeparator + name
+	}
+	channel.namespaces[name] = ns
+	return ns
+}
+
+// Name of namespace (empty for root channel)
+func (channel *Channel) Name() string {
+	return channel.namespace
+}
+
+// wrap wraps handler with middlewares of channel and its parents (root middlewares are outermost)
+func (channel *Channel) wrap(h Handler) Handler {
+	for ch := channel; ch != nil; ch = ch.parent {
+		h = ch.mws.Wrap(h)
+	}
+	return h
+}
+
+// onPanic returns OnPanic of channel or of its nearest parent which has it
+func (channel *Channel) onPanic() PanicHandler {
+	for ch := channel; ch != nil; ch = ch.parent {
+		if ch.OnPanic != nil {
+			return ch.OnPanic
+		}
+	}
+	return nil
+}
+
+// recoveryDisabled returns true if DisableRecovery is set on channel or any of its parents
+func (channel *Channel) recoveryDisabled() bool {
+	for ch := channel; ch != nil; ch = ch.parent {
+		if ch.DisableRecovery {
+			return true
+		}
+	}
+	return false
+}
+
+// handlerTimeout returns HandlerTimeout of channel or of its nearest parent which has it
+func (channel *Channel) handlerTimeout() time.Duration {
+	for ch := channel; ch != nil; ch = ch.parent {
+		if ch.HandlerTimeout > 0 {
+			return ch.HandlerTimeout
+		}
+	}
+	return 0
+}
+
+// broadcastConcurrency returns BroadcastConcurrency of channel or of its nearest parent which has it
+func (channel *Channel) broadcastConcurrency() int {
+	for ch := channel; ch != nil; ch = ch.parent {
+		if ch.BroadcastConcurrency > 0 {
+			return ch.BroadcastConcurrency
+		}
+	}
+	return 0
+}
+
+// root returns channel which physical connections are handled by
+func (channel *Channel) root() *Channel {
+	for channel.parent != nil {
+		channel = channel.parent
+	}
+	return channel
+}
+
+func (channel *Channel) getNamespace(name string) (*Channel, bool) {
+	channel.nsMutex.RLock()
+	defer channel.nsMutex.RUnlock()
+	ns, ok := channel.namespaces[name]
+	return ns, ok
+}
+
+// join returns namespace connection of parent connection (creates it and runs connect hooks on first call)
+func (channel *Channel) join(parent *Connection) (*Connection, bool) {
+	parent.nsMutex.Lock()
+	if parent.nsLeft {
+		parent.nsMutex.Unlock()
+		return nil, false
+	}
+	if c, ok := parent.nsConns[channel.namespace]; ok {
+		parent.nsMutex.Unlock()
+		return c, true
+	}
+
+	c := &Connection{
+		valuesMap:  newValuesMap(),
+		id:         parent.id,
+		channel:    channel,
+		conn:       nsConn{parent: parent},
+		context:    parent.context,
+		subscribes: make(map[string]bool),
+		labels:     make(map[string]bool),
+		timeout:    parent.timeout,
+		wsClient:   parent.wsClient,
+		origin:     parent.origin,
+		remoteIP:   parent.remoteIP,
+		handshake:  parent.handshake,
+		parent:     parent,
+		nsConns:    map[string]*Connection{},
+	}
+	c.ctx, c.cancel = context.WithCancel(parent.ctx)
+	channel.connMap.Set(c.id, c)
+	c.setUser(parent.User().ID())
+	parent.nsConns[channel.namespace] = c
+	parent.nsMutex.Unlock()
+
+	go channel.hook("ws-server-connect", c)
+	go channel.reliable.resend(c)
+	return c, true
+}
+
+// Namespace of connection (empty for physical connection)
+func (c *Connection) Namespace() string {
+	if c.channel == nil {
+		return ""
+	}
+	return c.channel.namespace
+}
+
+// leaveNamespaces closes namespace connections (no namespaces can be joined after that)
+func (c *Connection) leaveNamespaces() {
+	c.nsMutex.Lock()
+	c.nsLeft = true
+	conns := c.nsConns
+	c.nsConns = map[string]*Connection{}
+	c.nsMutex.Unlock()
+
+	for _, nc := range conns {
+		nc.Close()
+	}
+}
+
+// leaveParent detaches closed namespace connection from physical one and runs disconnect hooks
+// (next message to the namespace joins it again)
+func (c *Connection) leaveParent() {
+	c.parent.nsMutex.Lock()
+	if c.parent.nsConns[c.channel.namespace] == c {
+		delete(c.parent.nsConns, c.channel.namespace)
+	}
+	c.parent.nsMutex.Unlock()
+	go c.channel.hook("ws-server-disconnect", c)
+}
+
+// Namespace returns client of logical channel multiplexed over this client connection
+// (same Send, Request, Read and Subscribe API; namespace is joined on every connect)
+func (c *Client) Namespace(name string) *Client {
+	c.nsMutex.Lock()
+	defer c.nsMutex.Unlock()
+	if ns, ok := c.namespaces[name]; ok {
+		return ns
+	}
+
+	ns := &Client{
+		parent:        c,
+		namespace:     name,
+		subscriptions: map[string]bool{},
+		readers:       newReaderMap(),
+		requests:      newRequestsMap(),
+		mws:           newMiddlewareList(),
+		namespaces:    map[string]*Client{},
+		dedup:         newDedupSet(),
+		timeout:       c.timeout,
+		debug:         c.debug,
+		options:       c.options,
+		Reconnect:     c.Reconnect,
+	}
+	c.namespaces[name] = ns
+	if c.isConnected() {
+		ns.Send(namespaceJoin, "")
+	}
+	return ns
+}
+
+// root returns client with physical connection
+func (c *Client) root() *Client {
+	for c.parent != nil {
+		c = c.parent
+	}
+	return c
+}
+
+func (c *Client) isConnected() bool {
+	return c.root().connected
+}
+
+func (c *Client) getNamespace(name string) (*Client, bool) {
+	c.nsMutex.RLock()
+	defer c.nsMutex.RUnlock()
+	ns, ok := c.namespaces[name]
+	return ns, ok
+}
+
+// resubscribe sends subscriptions and joins namespaces after connect
+func (c *Client) resubscribe() {
+	cmds := []string{}
+	c.subLock.RLock()
+	for command := range c.subscriptions {
+		cmds = append(cmds, command)
+	}
+	c.subLock.RUnlock()
+
+	for _, command := range cmds {
+		c.Send("subscribe", command)
+	}
+
+	c.nsMutex.RLock()
+	nss := make([]*Client, 0, len(c.namespaces))
+	for _, ns := range c.namespaces {
+		nss = append(nss, ns)
+	}
+	c.nsMutex.RUnlock()
+
+	for _, ns := range nss {
+		ns.Send(namespaceJoin, "")
+		ns.resubscribe()
+	}
+}
@@ -0,0 +1,165 @@
+package ws
+
+import (
+	"io"
+	"log"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNamespaceMiddlewares(t *testing.T) {
+	channel := NewChannel()
+	chat := channel.Namespace("chat")
+	room := chat.Namespace("room")
+	c, _ := testConnection(channel, 1, nil, "")
+
+	var (
+		mutex sync.Mutex
+		calls []string
+	)
+	record := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(a *Adapter) {
+				if a.Command() == "cmd" { // not connect hooks
+					mutex.Lock()
+					calls = append(calls, name)
+					mutex.Unlock()
+				}
+				next(a)
+			}
+		}
+	}
+	channel.Use(record("root"))
+	chat.Use(record("chat"))
+	room.Use(record("room"))
+	room.Read("cmd", func(a *Adapter) {}, record("handler"))
+
+	channel.process(c, 1, "chat|room|cmd", []byte(`""`))
+	mutex.Lock()
+	defer mutex.Unlock()
+	if want := []string{"root", "chat", "room", "handler"}; !reflect.DeepEqual(calls, want) {
+		t.Fatalf("middlewares run in order %v; want %v", calls, want)
+	}
+}
+
+// settings of channel inherited by namespaces
+type settings struct {
+	onPanic              string // name of OnPanic handler
+	disableRecovery      bool
+	handlerTimeout       time.Duration
+	broadcastConcurrency int
+}
+
+func TestNamespaceSettings(t *testing.T) {
+	var called string
+	panicHandler := func(name string) PanicHandler {
+		if name == "" {
+			return nil
+		}
+		return func(a *Adapter, err interface{}, stack []byte) { called = name }
+	}
+	set := func(channel *Channel, s settings) {
+		channel.OnPanic = panicHandler(s.onPanic)
+		channel.DisableRecovery = s.disableRecovery
+		channel.HandlerTimeout = s.handlerTimeout
+		channel.BroadcastConcurrency = s.broadcastConcurrency
+	}
+	tests := []struct {
+		name     string
+		root, ns settings
+		want     settings
+	}{
+		{"defaults", settings{}, settings{}, settings{}},
+		{
+			"inherited",
+			settings{"root", true, time.Second, 4},
+			settings{},
+			settings{"root", true, time.Second, 4},
+		},
+		{
+			"own",
+			settings{"root", false, time.Second, 4},
+			settings{"ns", true, time.Minute, 2},
+			settings{"ns", true, time.Minute, 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			channel := NewChannel()
+			set(channel, tt.root)
+			ns := channel.Namespace("a").Namespace("b")
+			set(ns, tt.ns)
+
+			got := settings{
+				disableRecovery:      ns.recoveryDisabled(),
+				handlerTimeout:       ns.commandTimeout("cmd"),
+				broadcastConcurrency: ns.broadcastConcurrency(),
+			}
+			called = ""
+			if onPanic := ns.onPanic(); onPanic != nil {
+				onPanic(nil, nil, nil)
+				got.onPanic = called
+			}
+			if got != tt.want {
+				t.Fatalf("namespace settings %+v; want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNamespaceInheritedHandling(t *testing.T) {
+	log.SetOutput(io.Discard) // panic stacks
+	defer log.SetOutput(os.Stderr)
+
+	channel := NewChannel()
+	channel.HandlerTimeout = 20 * time.Millisecond
+	panics := make(chan interface{}, 1)
+	channel.OnPanic = func(a *Adapter, err interface{}, stack []byte) { panics <- err }
+	chat := channel.Namespace("chat")
+	chat.Read("panic", func(a *Adapter) { panic("boom") })
+	chat.Read("slow", func(a *Adapter) {
+		select {
+		case <-a.Ctx().Done():
+		case <-time.After(time.Second / 2):
+		}
+	})
+
+	tests := []struct {
+		command  string
+		wantCode int
+	}{
+		{"chat|panic", ErrCodeInternal},
+		{"chat|slow", ErrCodeTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			c, _ := testConnection(channel, 1, nil, "")
+			defer c.Close()
+			channel.process(c, 1, tt.command, []byte(`""`))
+			time.Sleep(10 * time.Millisecond)
+			if _, errs := replies(c); len(errs) != 1 || errs[0].Code != tt.wantCode {
+				t.Fatalf("error replies %v; want code %d", errs, tt.wantCode)
+			}
+		})
+	}
+	select {
+	case err := <-panics:
+		if err != "boom" {
+			t.Fatalf("OnPanic got %v; want boom", err)
+		}
+	default:
+		t.Fatal("OnPanic of parent isn't called for namespace handler")
+	}
+
+	channel.DisableRecovery = true
+	c, _ := testConnection(channel, 2, nil, "")
+	defer func() {
+		if rec := recover(); rec != "boom" {
+			t.Fatalf("recovered %v with DisableRecovery of parent; want boom", rec)
+		}
+	}()
+	channel.process(c, 1, "chat|panic", []byte(`""`))
+}
@@ -0,0 +1,46 @@
+package ws
+
+import (
+	"net/url"
+	"strings"
+)
+
+// OriginAllowed checks request Origin header for allowed origins list of connector:
+// empty list allows same origin only (Origin host equals to request host),
+// "*" allows any origin, "https://*.example.com" allows subdomains and
+// origins without scheme ("example.com") match any scheme
+func OriginAllowed(origin, host string, allowed []string) bool {
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if len(allowed) == 0 {
+		return strings.EqualFold(u.Host, host)
+	}
+
+	for _, pattern := range allowed {
+		if pattern == "*" {
+			return true
+		}
+		scheme := ""
+		if i := strings.Index(pattern, "://"); i >= 0 {
+			scheme, pattern = pattern[:i], pattern[i+3:]
+		}
+		if scheme != "" && !strings.EqualFold(scheme, u.Scheme) {
+			continue
+		}
+		if strings.HasPrefix(pattern, "*.") {
+			if suffix := pattern[1:]; len(u.Host) > len(suffix) && strings.EqualFold(u.Host[len(u.Host)-len(suffix):], suffix) {
+				return true
+			}
+			continue
+		}
+		if strings.EqualFold(pattern, u.Host) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,34 @@
+package ws
+
+import "testing"
+
+func TestOriginAllowed(t *testing.T) {
+	tests := []struct {
+		origin  string
+		host    string
+		allowed []string
+		want    bool
+	}{
+		{"", "example.com", nil, true},
+		{"https://example.com", "example.com", nil, true},
+		{"https://EXAMPLE.com", "example.com", nil, true},
+		{"https://evil.com", "example.com", nil, false},
+		{"https://evil.com", "example.com", []string{"*"}, true},
+		{"https://app.example.com", "x", []string{"https://app.example.com"}, true},
+		{"http://app.example.com", "x", []string{"https://app.example.com"}, false},
+		{"http://app.example.com", "x", []string{"app.example.com"}, true},
+		{"https://a.example.com", "x", []string{"https://*.example.com"}, true},
+		{"https://a.b.example.com", "x", []string{"*.example.com"}, true},
+		{"https://example.com", "x", []string{"*.example.com"}, false},
+		{"https://badexample.com", "x", []string{"*.example.com"}, false},
+		{"https://example.com:8080", "x", []string{"example.com:8080"}, true},
+		{"https://example.com:8080", "x", []string{"example.com"}, false},
+		{"https://other.com", "x", []string{"example.com", "other.com"}, true},
+		{"://bad", "x", []string{"*"}, false},
+	}
+	for _, tt := range tests {
+		if got := OriginAllowed(tt.origin, tt.host, tt.allowed); got != tt.want {
+			t.Errorf("OriginAllowed(%q, %q, %q) = %v; want %v", tt.origin, tt.host, tt.allowed, got, tt.want)
+		}
+	}
+}
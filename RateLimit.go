@@ -0,0 +1,191 @@
+package ws
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// Rate is token bucket limit: Rate messages per second with Burst size (zero Rate is unlimited)
+	Rate struct {
+		Rate  float64
+		Burst int
+	}
+
+	// RateLimits of inbound messages
+	RateLimits struct {
+		Connection Rate
+		User       Rate
+		IP         Rate
+		// Commands limits are applied per connection for each command. Keys are command names of handlers
+		// ("message" limits it in root channel and in each namespace), "chat|message" limits namespace command only.
+		Commands map[string]Rate
+		Action   RateLimitAction
+	}
+
+	// RateLimitAction is action on rate limit overflow
+	RateLimitAction int
+
+	rateLimiter struct {
+		sync.Mutex
+		limits   RateLimits
+		conns    map[uint64]*bucket
+		users    map[interface{}]*bucket
+		ips      map[string]*bucket
+		commands map[uint64]map[string]*bucket
+	}
+
+	bucket struct {
+		tokens float64
+		last   time.Time
+	}
+)
+
+// Rate limit overflow actions
+const (
+	// RateLimitDrop drops message silently
+	RateLimitDrop RateLimitAction = iota
+	// RateLimitReply drops message and replies with ErrCodeRateLimit error to the request
+	RateLimitReply
+	// RateLimitClose closes connection with policy violation code
+	RateLimitClose
+)
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{
+		conns:    make(map[uint64]*bucket),
+		users:    make(map[interface{}]*bucket),
+		ips:      make(map[string]*bucket),
+		commands: make(map[uint64]map[string]*bucket),
+	}
+}
+
+// SetLimits replaces limits and resets all buckets
+func (l *rateLimiter) SetLimits(limits RateLimits) {
+	l.Lock()
+	l.limits = limits
+	l.conns = make(map[uint64]*bucket)
+	l.users = make(map[interface{}]*bucket)
+	l.ips = make(map[string]*bucket)
+	l.commands = make(map[uint64]map[string]*bucket)
+	l.Unlock()
+}
+
+func (l *rateLimiter) Action() RateLimitAction {
+	l.Lock()
+	defer l.Unlock()
+	return l.limits.Action
+}
+
+// Allow takes token from each connection bucket and returns false if one of them is empty
+func (l *rateLimiter) Allow(c *Connection, command string) bool {
+	now := time.Now()
+	l.Lock()
+	defer l.Unlock()
+
+	if l.limits.Connection.Rate > 0 {
+		b, ok := l.conns[c.id]
+		if !ok {
+			b = newBucket(l.limits.Connection, now)
+			l.conns[c.id] = b
+		}
+		if !b.Take(l.limits.Connection, now) {
+			return false
+		}
+	}
+	if user := c.User(); l.limits.User.Rate > 0 && user != nil {
+		b, ok := l.users[user.id]
+		if !ok {
+			b = newBucket(l.limits.User, now)
+			l.users[user.id] = b
+		}
+		if !b.Take(l.limits.User, now) {
+			return false
+		}
+	}
+	if l.limits.IP.Rate > 0 && c.remoteIP != "" {
+		b, ok := l.ips[c.remoteIP]
+		if !ok {
+			b = newBucket(l.limits.IP, now)
+			l.ips[c.remoteIP] = b
+		}
+		if !b.Take(l.limits.IP, now) {
+			return false
+		}
+	}
+	if rate, ok := l.commandRate(command); ok && rate.Rate > 0 {
+		cmds, ok := l.commands[c.id]
+		if !ok {
+			cmds = make(map[string]*bucket)
+			l.commands[c.id] = cmds
+		}
+		b, ok := cmds[command]
+		if !ok {
+			b = newBucket(rate, now)
+			cmds[command] = b
+		}
+		if !b.Take(rate, now) {
+			return false
+		}
+	}
+	return true
+}
+
+// Forget removes buckets of closed connection (and of its user and IP if they have no connections more)
+func (l *rateLimiter) Forget(c *Connection, lastOfUser, lastOfIP bool) {
+	l.Lock()
+	delete(l.conns, c.id)
+	delete(l.commands, c.id)
+	if user := c.User(); lastOfUser && user != nil {
+		delete(l.users, user.id)
+	}
+	if lastOfIP {
+		delete(l.ips, c.remoteIP)
+	}
+	l.Unlock()
+}
+
+// ForgetUser removes bucket of user without connections
+func (l *rateLimiter) ForgetUser(userID interface{}) {
+	l.Lock()
+	delete(l.users, userID)
+	l.Unlock()
+}
+
+// commandRate returns limit of wire command ("chat|message" limit or "message" limit for namespace commands)
+func (l *rateLimiter) commandRate(command string) (Rate, bool) {
+	if rate, ok := l.limits.Commands[command]; ok {
+		return rate, true
+	}
+	if i := strings.LastIndex(command, namespaceSeparator); i >= 0 {
+		rate, ok := l.limits.Commands[command[i+len(namespaceSeparator):]]
+		return rate, ok
+	}
+	return Rate{}, false
+}
+
+func newBucket(rate Rate, now time.Time) *bucket {
+	return &bucket{tokens: float64(burst(rate)), last: now}
+}
+
+// Take refills bucket and takes one token if it is possible
+func (b *bucket) Take(rate Rate, now time.Time) bool {
+	b.tokens += now.Sub(b.last).Seconds() * rate.Rate
+	if max := float64(burst(rate)); b.tokens > max {
+		b.tokens = max
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+func burst(rate Rate) int {
+	if rate.Burst < 1 {
+		return 1
+	}
+	return rate.Burst
+}
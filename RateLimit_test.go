@@ -0,0 +1,57 @@
+package ws
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBucketTake(t *testing.T) {
+	start := time.Unix(1000, 0)
+	tests := []struct {
+		name  string
+		rate  Rate
+		takes []time.Duration // offsets from start
+		want  []bool
+	}{
+		{"burst", Rate{Rate: 1, Burst: 3}, []time.Duration{0, 0, 0, 0}, []bool{true, true, true, false}},
+		{"zero burst is one", Rate{Rate: 1}, []time.Duration{0, 0}, []bool{true, false}},
+		{"refill", Rate{Rate: 2, Burst: 1}, []time.Duration{0, 0, 250 * time.Millisecond, 500 * time.Millisecond, 500 * time.Millisecond}, []bool{true, false, false, true, false}},
+		{"refill is capped by burst", Rate{Rate: 10, Burst: 2}, []time.Duration{0, 0, time.Hour, time.Hour, time.Hour}, []bool{true, true, true, true, false}},
+		{"fractional rate", Rate{Rate: 0.5, Burst: 1}, []time.Duration{0, time.Second, 2 * time.Second}, []bool{true, false, true}},
+	}
+	for _, tt := range tests {
+		b := newBucket(tt.rate, start)
+		for i, offset := range tt.takes {
+			if got := b.Take(tt.rate, start.Add(offset)); got != tt.want[i] {
+				t.Errorf("%s: Take #%d at %v = %v; want %v", tt.name, i, offset, got, tt.want[i])
+			}
+		}
+	}
+}
+
+func TestCommandRate(t *testing.T) {
+	l := newRateLimiter()
+	l.SetLimits(RateLimits{Commands: map[string]Rate{
+		"message":      {Rate: 1},
+		"chat|message": {Rate: 2},
+		"upload":       {Rate: 3},
+	}})
+
+	tests := []struct {
+		command string
+		want    float64
+		ok      bool
+	}{
+		{"message", 1, true},
+		{"chat|message", 2, true},
+		{"news|message", 1, true},
+		{"chat|files|upload", 3, true},
+		{"ping", 0, false},
+		{"chat|ping", 0, false},
+	}
+	for _, tt := range tests {
+		if rate, ok := l.commandRate(tt.command); ok != tt.ok || rate.Rate != tt.want {
+			t.Errorf("commandRate(%q) = %v, %v; want %v, %v", tt.command, rate.Rate, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,393 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// reliableCommand is reserved command of reliable messages envelopes
+	reliableCommand = "ws-reliable"
+	// ackCommand is reserved command of reliable messages acknowledgements
+	ackCommand = "ws-ack"
+
+	defaultRetransmitInterval = 5 * time.Second
+	defaultReliableTTL        = time.Hour
+	// dedupSize is number of remembered IDs of received reliable messages
+	dedupSize = 10000
+)
+
+type (
+	// reliableEnvelope is wire format of reliable message
+	reliableEnvelope struct {
+		ID      string          `json:"id"`
+		Command string          `json:"command"`
+		Data    json.RawMessage `json:"data"`
+	}
+
+	reliableMessage struct {
+		envelope reliableEnvelope
+		connID   uint64      // target connection (0 is any connection of user)
+		userID   interface{} // nil for anonymous users (message can't outlive connection)
+		expires  time.Time
+		timer    *time.Timer
+	}
+
+	// reliableQueue keeps unacknowledged messages of channel and retransmits them
+	reliableQueue struct {
+		sync.Mutex
+		channel  *Channel
+		prefix   string
+		lastID   uint64
+		messages map[string]*reliableMessage
+		waiters  map[string]*ackWaiter // acknowledgements of SendWithAck messages
+	}
+
+	// ackWaiter waits for acknowledgement of SendWithAck message from target connection
+	ackWaiter struct {
+		connID uint64
+		acked  chan struct{}
+	}
+
+	// dedupSet remembers IDs of received reliable messages (false while handler is running)
+	dedupSet struct {
+		sync.Mutex
+		done  map[string]bool
+		order []string
+	}
+)
+
+// ErrAnonymousUser is returned by User.SendReliable for users without ID
+var ErrAnonymousUser = errors.New("reliable messages need user with ID")
+
+func newReliableQueue(channel *Channel) *reliableQueue {
+	return &reliableQueue{
+		channel:  channel,
+		prefix:   fmt.Sprintf("%x", rand.New(rand.NewSource(time.Now().UnixNano())).Uint32()),
+		messages: make(map[string]*reliableMessage),
+		waiters:  make(map[string]*ackWaiter),
+	}
+}
+
+// SendReliable sends message with at-least-once delivery: it is retransmitted (Channel.RetransmitInterval)
+// until client acknowledges it or Channel.ReliableTTL expires. If connection is closed, message is
+// delivered to other and new connections of the same user. Returns message ID.
+func (c *Connection) SendReliable(command string, message interface{}) (string, error) {
+	if c.channel == nil {
+		return "", fmt.Errorf("Connection %d: %w", c.ID(), ErrConnectionClosed)
+	}
+	var userID interface{}
+	if user := c.User(); user != nil {
+		userID = user.ID()
+	}
+	return c.channel.reliable.send(c.ID(), userID, command, message)
+}
+
+// SendReliable sends message to user with at-least-once delivery: it is retransmitted to all
+// user's connections (including new ones) until one of them acknowledges it. Returns message ID.
+func (u *User) SendReliable(command string, message interface{}) (string, error) {
+	if u.id == nil {
+		return "", ErrAnonymousUser
+	}
+	if u.channel == nil {
+		return "", errors.New("ws: user isn't bound to channel")
+	}
+	return u.channel.reliable.send(0, u.id, command, message)
+}
+
+func (q *reliableQueue) send(connID uint64, userID interface{}, command string, message interface{}) (string, error) {
+	data, err := rawJSON(message)
+	if err != nil {
+		return "", fmt.Errorf("WS: SendReliable: json.Marshal: %v", err)
+	}
+
+	m := &reliableMessage{
+		envelope: reliableEnvelope{
+			ID:      q.nextID(),
+			Command: command,
+			Data:    data,
+		},
+		connID:  connID,
+		userID:  userID,
+		expires: time.Now().Add(q.ttl()),
+	}
+	q.Lock()
+	q.messages[m.envelope.ID] = m
+	m.timer = time.AfterFunc(q.interval(), func() { q.retransmit(m) })
+	q.Unlock()
+
+	for _, c := range q.targets(m) {
+		c.Send(reliableCommand, m.envelope)
+	}
+	return m.envelope.ID, nil
+}
+
+// SendWithAck sends message and waits until client handlers acknowledge it.
+// It fails when ctx is done or connection is closed before acknowledgement (message isn't retransmitted).
+func (c *Connection) SendWithAck(ctx context.Context, command string, message interface{}) error {
+	err := c.sendWithAck(ctx, command, message)
+	if errors.Is(err, ErrConnectionClosed) {
+		return fmt.Errorf("Connection %d: %w", c.ID(), err)
+	}
+	return err
+}
+
+// sendWithAck is SendWithAck with errors without connection ID (for ConnectionError of reports)
+func (c *Connection) sendWithAck(ctx context.Context, command string, message interface{}) error {
+	if c.channel == nil || c.isClosed() {
+		return ErrConnectionClosed
+	}
+	return c.channel.reliable.sendWithAck(ctx, c, command, message)
+}
+
+func (q *reliableQueue) sendWithAck(ctx context.Context, c *Connection, command string, message interface{}) error {
+	data, err := rawJSON(message)
+	if err != nil {
+		return fmt.Errorf("json.Marshal: %v", err)
+	}
+
+	envelope := reliableEnvelope{ID: q.nextID(), Command: command, Data: data}
+	acked := make(chan struct{})
+	q.Lock()
+	q.waiters[envelope.ID] = &ackWaiter{connID: c.ID(), acked: acked}
+	q.Unlock()
+	defer func() {
+		q.Lock()
+		delete(q.waiters, envelope.ID)
+		q.Unlock()
+	}()
+
+	if err := c.Send(reliableCommand, envelope); err != nil {
+		if errors.Is(err, ErrConnectionClosed) {
+			return ErrConnectionClosed
+		}
+		return err
+	}
+	select {
+	case <-acked:
+		return nil
+	case <-c.Ctx().Done():
+		return ErrConnectionClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// sendWithAck sends message to connections in parallel and collects acknowledgements to delivery report
+func sendWithAck(ctx context.Context, conns map[uint64]*Connection, command string, message interface{}) DeliveryReport {
+	report := DeliveryReport{}
+	var (
+		wg          sync.WaitGroup
+		reportMutex sync.Mutex
+	)
+	for _, connection := range conns {
+		wg.Add(1)
+		go func(connection *Connection) {
+			defer wg.Done()
+			err := connection.sendWithAck(ctx, command, message)
+			reportMutex.Lock()
+			defer reportMutex.Unlock()
+			if err != nil {
+				report.Failed++
+				report.Errors = append(report.Errors, &ConnectionError{ConnID: connection.ID(), Err: err})
+				return
+			}
+			report.Delivered++
+		}(connection)
+	}
+	wg.Wait()
+	return report
+}
+
+func (q *reliableQueue) nextID() string {
+	return fmt.Sprintf("%s-%d", q.prefix, atomic.AddUint64(&q.lastID, 1))
+}
+
+// targets returns connections of message: target connection or connections of its user
+func (q *reliableQueue) targets(m *reliableMessage) []*Connection {
+	if m.connID != 0 {
+		if c, ok := q.channel.connMap.GetEx(m.connID); ok {
+			return []*Connection{c}
+		}
+	}
+	if m.userID == nil {
+		return nil
+	}
+	conns := []*Connection{}
+	if user, ok := q.channel.users.GetEx(m.userID); ok {
+		for _, c := range user.connMap.Copy() {
+			conns = append(conns, c)
+		}
+	}
+	return conns
+}
+
+func (q *reliableQueue) retransmit(m *reliableMessage) {
+	q.Lock()
+	if _, ok := q.messages[m.envelope.ID]; !ok {
+		q.Unlock()
+		return
+	}
+	targets := q.targets(m)
+	if time.Now().After(m.expires) || (len(targets) == 0 && m.userID == nil) {
+		delete(q.messages, m.envelope.ID)
+		q.Unlock()
+		return
+	}
+	m.timer.Reset(q.interval())
+	q.Unlock()
+
+	for _, c := range targets {
+		c.Send(reliableCommand, m.envelope)
+	}
+}
+
+// resend sends unacknowledged messages of connection user (on connect and user change)
+func (q *reliableQueue) resend(c *Connection) {
+	user := c.User()
+	if user == nil || user.ID() == nil {
+		return
+	}
+	q.Lock()
+	envelopes := []reliableEnvelope{}
+	for _, m := range q.messages {
+		if m.userID == user.ID() {
+			envelopes = append(envelopes, m.envelope)
+		}
+	}
+	q.Unlock()
+
+	for _, envelope := range envelopes {
+		c.Send(reliableCommand, envelope)
+	}
+}
+
+// ack removes message acknowledged by connection (only target connection or connections of its user can ack it)
+func (q *reliableQueue) ack(id string, c *Connection) {
+	q.Lock()
+	if m, ok := q.messages[id]; ok && m.ackedBy(c) {
+		m.timer.Stop()
+		delete(q.messages, id)
+	}
+	if w, ok := q.waiters[id]; ok && w.connID == c.ID() {
+		close(w.acked)
+		delete(q.waiters, id)
+	}
+	q.Unlock()
+}
+
+// ackedBy returns true if connection is allowed to acknowledge message
+func (m *reliableMessage) ackedBy(c *Connection) bool {
+	if m.connID != 0 && m.connID == c.ID() {
+		return true
+	}
+	user := c.User()
+	return m.userID != nil && user != nil && user.ID() == m.userID
+}
+
+func (q *reliableQueue) interval() time.Duration {
+	if q.channel.RetransmitInterval > 0 {
+		return q.channel.RetransmitInterval
+	}
+	return defaultRetransmitInterval
+}
+
+func (q *reliableQueue) ttl() time.Duration {
+	if q.channel.ReliableTTL > 0 {
+		return q.channel.ReliableTTL
+	}
+	return defaultReliableTTL
+}
+
+// ackReader handles built-in "ws-ack" command of reliable messages acknowledgements
+func (channel *Channel) ackReader() {
+	channel.Read(ackCommand, func(a *Adapter) {
+		channel.reliable.ack(a.StringData(), a.Connection())
+	})
+}
+
+// receiveReliable runs handlers of reliable message once and acknowledges it after they return
+// (message without handler isn't acknowledged, so it is retransmitted until handler is added or it expires)
+func (c *Client) receiveReliable(data []byte) {
+	envelope := reliableEnvelope{}
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return
+	}
+	if done, seen := c.dedup.Seen(envelope.ID); seen {
+		if done { // retransmission of processed message: acknowledgement was lost
+			c.Send(ackCommand, envelope.ID)
+		}
+		return
+	}
+	if !c.process(0, envelope.Command, envelope.Data) {
+		c.dedup.Forget(envelope.ID)
+		return
+	}
+	c.dedup.Done(envelope.ID)
+	c.Send(ackCommand, envelope.ID)
+}
+
+func newDedupSet() *dedupSet {
+	return &dedupSet{done: make(map[string]bool)}
+}
+
+// Seen marks id as received and returns its state if it was received before
+func (s *dedupSet) Seen(id string) (done, seen bool) {
+	s.Lock()
+	defer s.Unlock()
+	if done, seen = s.done[id]; seen {
+		return
+	}
+	s.done[id] = false
+	s.order = append(s.order, id)
+	if len(s.order) > dedupSize {
+		delete(s.done, s.order[0])
+		s.order = s.order[1:]
+	}
+	return
+}
+
+// Done marks id as processed
+func (s *dedupSet) Done(id string) {
+	s.Lock()
+	if _, ok := s.done[id]; ok {
+		s.done[id] = true
+	}
+	s.Unlock()
+}
+
+// Forget removes id, so its retransmission is processed again
+func (s *dedupSet) Forget(id string) {
+	s.Lock()
+	defer s.Unlock()
+	if _, ok := s.done[id]; !ok {
+		return
+	}
+	delete(s.done, id)
+	for i, v := range s.order {
+		if v == id {
+			s.order = append(s.order[:i], s.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// rawJSON returns JSON of message ([]byte message is used as is if it is valid JSON)
+func rawJSON(message interface{}) (json.RawMessage, error) {
+	switch m := message.(type) {
+	case []byte:
+		if json.Valid(m) {
+			return m, nil
+		}
+		return json.Marshal(string(m))
+	case *[]byte:
+		return rawJSON(*m)
+	}
+	return json.Marshal(message)
+}
@@ -0,0 +1,179 @@
+package ws
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// reliableSent returns number of envelopes of reliable message id written to connection
+func reliableSent(c *Connection, id string) int {
+	n := 0
+	for _, msg := range written(c) {
+		if strings.Contains(msg, `"`+reliableCommand+`"`) && strings.Contains(msg, `"`+id+`"`) {
+			n++
+		}
+	}
+	return n
+}
+
+// queued returns true if reliable message id isn't acknowledged or expired yet
+func queued(channel *Channel, id string) bool {
+	channel.reliable.Lock()
+	defer channel.reliable.Unlock()
+	_, ok := channel.reliable.messages[id]
+	return ok
+}
+
+func TestDedupSet(t *testing.T) {
+	fill := func(s *dedupSet) {
+		for i := 0; i <= dedupSize; i++ {
+			s.Seen(strconv.Itoa(i))
+		}
+	}
+	tests := []struct {
+		name       string
+		prepare    func(s *dedupSet)
+		id         string
+		done, seen bool
+	}{
+		{"new", func(s *dedupSet) {}, "a", false, false},
+		{"running", func(s *dedupSet) { s.Seen("a") }, "a", false, true},
+		{"done", func(s *dedupSet) { s.Seen("a"); s.Done("a") }, "a", true, true},
+		{"done before seen", func(s *dedupSet) { s.Done("a") }, "a", false, false},
+		{"forgotten", func(s *dedupSet) { s.Seen("a"); s.Done("a"); s.Forget("a") }, "a", false, false},
+		{"evicted oldest", fill, "0", false, false},
+		{"kept newer", fill, "1", false, true},
+		{"kept newest", fill, strconv.Itoa(dedupSize), false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newDedupSet()
+			tt.prepare(s)
+			if done, seen := s.Seen(tt.id); done != tt.done || seen != tt.seen {
+				t.Fatalf("Seen(%q) = %v, %v; want %v, %v", tt.id, done, seen, tt.done, tt.seen)
+			}
+			if len(s.order) != len(s.done) || len(s.order) > dedupSize {
+				t.Fatalf("%d ids in order, %d in set; want equal and at most %d", len(s.order), len(s.done), dedupSize)
+			}
+		})
+	}
+}
+
+func TestAckedBy(t *testing.T) {
+	channel := NewChannel()
+	a1, _ := testConnection(channel, 1, "a", "")
+	a2, _ := testConnection(channel, 2, "a", "")
+	b, _ := testConnection(channel, 3, "b", "")
+	anon1, _ := testConnection(channel, 4, nil, "")
+	anon2, _ := testConnection(channel, 5, nil, "")
+
+	tests := []struct {
+		name    string
+		message reliableMessage
+		c       *Connection
+		want    bool
+	}{
+		{"target connection", reliableMessage{connID: 1, userID: "a"}, a1, true},
+		{"other connection of user", reliableMessage{connID: 1, userID: "a"}, a2, true},
+		{"connection of user", reliableMessage{userID: "a"}, a2, true},
+		{"other user", reliableMessage{userID: "a"}, b, false},
+		{"other user of target connection", reliableMessage{connID: 1, userID: "a"}, b, false},
+		{"anonymous target connection", reliableMessage{connID: 4}, anon1, true},
+		{"other anonymous connection", reliableMessage{connID: 4}, anon2, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.message.ackedBy(tt.c); got != tt.want {
+				t.Fatalf("ackedBy(connection %d) = %v; want %v", tt.c.ID(), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReliableAckStopsRetransmission(t *testing.T) {
+	channel := NewChannel()
+	channel.RetransmitInterval = 10 * time.Millisecond
+	c, _ := testConnection(channel, 1, "a", "")
+	other, _ := testConnection(channel, 2, "b", "")
+
+	id, err := c.SendReliable("cmd", "data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * channel.RetransmitInterval)
+	if n := reliableSent(c, id); n < 2 {
+		t.Fatalf("message is sent %d times before ack; want retransmissions", n)
+	}
+
+	channel.reliable.ack(id, other)
+	if !queued(channel, id) {
+		t.Fatal("message is acknowledged by connection of other user")
+	}
+
+	channel.reliable.ack(id, c)
+	if queued(channel, id) {
+		t.Fatal("acknowledged message is still queued")
+	}
+	time.Sleep(2 * channel.RetransmitInterval) // retransmission which has been sent while ack
+	n := reliableSent(c, id)
+	time.Sleep(5 * channel.RetransmitInterval)
+	if got := reliableSent(c, id); got != n {
+		t.Fatalf("message is sent %d times after ack", got-n)
+	}
+}
+
+func TestReliableExpires(t *testing.T) {
+	channel := NewChannel()
+	channel.RetransmitInterval = 10 * time.Millisecond
+	channel.ReliableTTL = 50 * time.Millisecond
+	c, _ := testConnection(channel, 1, "a", "")
+
+	id, err := channel.User("a").SendReliable("cmd", "data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(channel.ReliableTTL / 2)
+	if !queued(channel, id) {
+		t.Fatal("message expired before TTL")
+	}
+
+	time.Sleep(channel.ReliableTTL + 2*channel.RetransmitInterval)
+	if queued(channel, id) {
+		t.Fatal("message is queued after TTL")
+	}
+	n := reliableSent(c, id)
+	time.Sleep(5 * channel.RetransmitInterval)
+	if got := reliableSent(c, id); got != n {
+		t.Fatalf("message is sent %d times after TTL", got-n)
+	}
+}
+
+func TestReliableResend(t *testing.T) {
+	channel := NewChannel()
+	old, _ := testConnection(channel, 1, "a", "")
+	id, err := channel.User("a").SendReliable("cmd", "data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	old.Close()
+
+	c, _ := testConnection(channel, 2, "a", "")
+	other, _ := testConnection(channel, 3, "b", "")
+	channel.reliable.resend(c)
+	channel.reliable.resend(other)
+	if n := reliableSent(c, id); n != 1 {
+		t.Fatalf("message is resent %d times to new connection of user; want 1", n)
+	}
+	if n := reliableSent(other, id); n != 0 {
+		t.Fatalf("message is resent %d times to connection of other user; want 0", n)
+	}
+
+	channel.reliable.ack(id, c)
+	c2, _ := testConnection(channel, 4, "a", "")
+	channel.reliable.resend(c2)
+	if n := reliableSent(c2, id); n != 0 {
+		t.Fatalf("acknowledged message is resent %d times; want 0", n)
+	}
+}
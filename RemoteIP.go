@@ -0,0 +1,104 @@
+package ws
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// SetTrustedProxies sets CIDRs (or single IPs) of proxies which forwarding headers
+// ("Forwarded", "X-Forwarded-For", "X-Real-IP") are used for remote IP resolution
+func (channel *Channel) SetTrustedProxies(cidrs ...string) error {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		if !strings.Contains(cidr, "/") {
+			if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return fmt.Errorf("WS: Channel.SetTrustedProxies: %v", err)
+		}
+		nets = append(nets, n)
+	}
+	channel.trustedProxies = nets
+	return nil
+}
+
+// resolveIP returns client IP of handshake request
+func (channel *Channel) resolveIP(info *HandshakeInfo) string {
+	peer := hostOnly(info.RemoteAddr)
+	if !channel.isTrusted(peer) {
+		return peer
+	}
+
+	if chain := forwardedFor(info.Header.Values("Forwarded")); len(chain) > 0 {
+		return channel.clientIP(chain, peer)
+	}
+	if chain := splitList(info.Header.Values("X-Forwarded-For")); len(chain) > 0 {
+		return channel.clientIP(chain, peer)
+	}
+	if ip := net.ParseIP(strings.TrimSpace(info.Header.Get("X-Real-IP"))); ip != nil {
+		return ip.String()
+	}
+	return peer
+}
+
+// clientIP returns the rightmost untrusted address of proxies chain
+func (channel *Channel) clientIP(chain []string, peer string) string {
+	ip := peer
+	for i := len(chain) - 1; i >= 0; i-- {
+		parsed := net.ParseIP(strings.Trim(hostOnly(chain[i]), "[]"))
+		if parsed == nil {
+			break
+		}
+		ip = parsed.String()
+		if !channel.isTrusted(ip) {
+			break
+		}
+	}
+	return ip
+}
+
+func (channel *Channel) isTrusted(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, n := range channel.trustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedFor returns "for" addresses of RFC 7239 "Forwarded" headers
+func forwardedFor(values []string) []string {
+	ret := []string{}
+	for _, element := range splitList(values) {
+		for _, pair := range strings.Split(element, ";") {
+			kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+			if len(kv) == 2 && strings.EqualFold(kv[0], "for") {
+				ret = append(ret, strings.Trim(kv[1], "\""))
+			}
+		}
+	}
+	return ret
+}
+
+// splitList splits comma-separated header values
+func splitList(values []string) []string {
+	ret := []string{}
+	for _, v := range values {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				ret = append(ret, item)
+			}
+		}
+	}
+	return ret
+}
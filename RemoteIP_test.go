@@ -0,0 +1,48 @@
+package ws
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestResolveIP(t *testing.T) {
+	channel := NewChannel()
+	if err := channel.SetTrustedProxies("10.0.0.0/8", "192.168.1.1", "fd00::/8"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		header     map[string]string
+		want       string
+	}{
+		{"direct", "203.0.113.5:1234", nil, "203.0.113.5"},
+		{"untrusted peer headers are ignored", "203.0.113.5:1234", map[string]string{"X-Forwarded-For": "1.2.3.4"}, "203.0.113.5"},
+		{"trusted peer without headers", "10.0.0.1:80", nil, "10.0.0.1"},
+		{"x-forwarded-for", "10.0.0.1:80", map[string]string{"X-Forwarded-For": "1.2.3.4"}, "1.2.3.4"},
+		{"x-forwarded-for skips trusted proxies", "10.0.0.1:80", map[string]string{"X-Forwarded-For": "6.6.6.6, 1.2.3.4, 192.168.1.1"}, "1.2.3.4"},
+		{"x-forwarded-for all trusted", "10.0.0.1:80", map[string]string{"X-Forwarded-For": "10.1.1.1, 10.2.2.2"}, "10.1.1.1"},
+		{"x-forwarded-for invalid entry", "10.0.0.1:80", map[string]string{"X-Forwarded-For": "garbage, 10.2.2.2"}, "10.2.2.2"},
+		{"forwarded", "10.0.0.1:80", map[string]string{"Forwarded": `for=1.2.3.4;proto=https, for=10.3.3.3`}, "1.2.3.4"},
+		{"forwarded ipv6", "10.0.0.1:80", map[string]string{"Forwarded": `for="[2001:db8::1]:4711"`}, "2001:db8::1"},
+		{"forwarded wins over x-forwarded-for", "10.0.0.1:80", map[string]string{"Forwarded": "for=1.2.3.4", "X-Forwarded-For": "5.6.7.8"}, "1.2.3.4"},
+		{"x-real-ip", "10.0.0.1:80", map[string]string{"X-Real-IP": " 1.2.3.4 "}, "1.2.3.4"},
+		{"ipv6 trusted peer", "[fd00::1]:80", map[string]string{"X-Forwarded-For": "2001:db8::2"}, "2001:db8::2"},
+	}
+	for _, tt := range tests {
+		info := &HandshakeInfo{RemoteAddr: tt.remoteAddr, Header: http.Header{}}
+		for k, v := range tt.header {
+			info.Header.Set(k, v)
+		}
+		if got := channel.resolveIP(info); got != tt.want {
+			t.Errorf("%s: resolveIP() = %q; want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSetTrustedProxiesError(t *testing.T) {
+	if err := NewChannel().SetTrustedProxies("10.0.0.0/33"); err == nil {
+		t.Fatal("SetTrustedProxies(invalid CIDR) = nil; want error")
+	}
+}
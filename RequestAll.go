@@ -0,0 +1,113 @@
+package ws
+
+import (
+	"context"
+	"fmt"
+)
+
+type (
+	// RequestAllOptions of Connections.RequestAll and User.RequestAll (all connections must answer by default)
+	RequestAllOptions struct {
+		// First is number of successful replies RequestAll returns after (at most number of connections)
+		First int
+		// Quorum makes RequestAll return after successful replies of majority of connections
+		Quorum bool
+	}
+
+	// Reply of connection to RequestAll request
+	Reply struct {
+		ConnID uint64
+		Data   []byte
+	}
+
+	// RequestReport of RequestAll: successful replies in order of arrival and errors of failed connections
+	// (connections which didn't answer before ctx is done have ctx error)
+	RequestReport struct {
+		Replies []Reply
+		Errors  []*ConnectionError
+		Needed  int // number of successful replies required by options
+	}
+
+	// RequestAllError is returned by RequestReport.Err when required number of replies isn't reached
+	RequestAllError struct {
+		ConnectionErrors
+		Replies int
+		Needed  int
+	}
+)
+
+// RequestAll sends request to connections in parallel and collects replies until all of them
+// (or required by options number of them) answered or ctx is done. Requests which are still pending
+// when required number of replies is reached are abandoned.
+func (cs Connections) RequestAll(ctx context.Context, command string, message interface{}, options ...RequestAllOptions) RequestReport {
+	return requestAll(ctx, cs.connMap.Copy(), command, message, options...)
+}
+
+// RequestAll sends request to open user's connections in parallel (see Connections.RequestAll)
+func (u *User) RequestAll(ctx context.Context, command string, message interface{}, options ...RequestAllOptions) RequestReport {
+	return requestAll(ctx, u.connMap.Copy(), command, message, options...)
+}
+
+func requestAll(ctx context.Context, conns map[uint64]*Connection, command string, message interface{}, options ...RequestAllOptions) RequestReport {
+	report := RequestReport{Needed: len(conns)}
+	if len(options) > 0 {
+		report.Needed = options[0].needed(len(conns))
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		connID uint64
+		data   []byte
+		err    error
+	}
+	results := make(chan result, len(conns))
+	for _, connection := range conns {
+		go func(connection *Connection) {
+			data, err := connection.request(ctx, command, message)
+			results <- result{connID: connection.ID(), data: data, err: err}
+		}(connection)
+	}
+
+	for pending := len(conns); pending > 0 && len(report.Replies) < report.Needed; pending-- {
+		r := <-results
+		if r.err != nil {
+			report.Errors = append(report.Errors, &ConnectionError{ConnID: r.connID, Err: r.err})
+			continue
+		}
+		report.Replies = append(report.Replies, Reply{ConnID: r.connID, Data: r.data})
+	}
+	return report
+}
+
+// needed returns number of required replies of n connections (no replies are required from empty set)
+func (o RequestAllOptions) needed(n int) int {
+	needed := 0
+	if o.First > 0 {
+		needed = o.First
+	}
+	if o.Quorum && n/2+1 > needed {
+		needed = n/2 + 1
+	}
+	if needed == 0 || needed > n {
+		needed = n
+	}
+	return needed
+}
+
+// Err returns *RequestAllError if required number of replies isn't reached (or nil)
+func (r RequestReport) Err() error {
+	if len(r.Replies) >= r.Needed {
+		return nil
+	}
+	return &RequestAllError{ConnectionErrors: r.Errors, Replies: len(r.Replies), Needed: r.Needed}
+}
+
+func (e *RequestAllError) Error() string {
+	msg := fmt.Sprintf("%d of %d required replies", e.Replies, e.Needed)
+	if len(e.ConnectionErrors) > 0 {
+		msg += "\n" + e.ConnectionErrors.Error()
+	}
+	return msg
+}
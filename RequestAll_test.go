@@ -0,0 +1,123 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// replyConn is websocket connection which answers server requests with its connection ID (if it is replying)
+type replyConn struct {
+	nopConn
+	c        *Connection
+	replying bool
+}
+
+func (r *replyConn) WriteMessage(_ int, data []byte) error {
+	msg := struct{ SrvRequestID int64 }{}
+	if err := json.Unmarshal(data, &msg); err != nil || msg.SrvRequestID >= 0 || !r.replying {
+		return nil
+	}
+	reply, _ := json.Marshal(r.c.ID())
+	go r.c.channel.process(r.c, msg.SrvRequestID, "reply", reply)
+	return nil
+}
+
+func TestRequestAllOptionsNeeded(t *testing.T) {
+	tests := []struct {
+		name    string
+		options RequestAllOptions
+		n       int
+		want    int
+	}{
+		{"no connections", RequestAllOptions{}, 0, 0},
+		{"no connections with First", RequestAllOptions{First: 2}, 0, 0},
+		{"no connections with Quorum", RequestAllOptions{Quorum: true}, 0, 0},
+		{"all", RequestAllOptions{}, 5, 5},
+		{"First", RequestAllOptions{First: 2}, 5, 2},
+		{"First over connections", RequestAllOptions{First: 7}, 5, 5},
+		{"negative First", RequestAllOptions{First: -1}, 5, 5},
+		{"Quorum of odd", RequestAllOptions{Quorum: true}, 5, 3},
+		{"Quorum of even", RequestAllOptions{Quorum: true}, 4, 3},
+		{"Quorum of one", RequestAllOptions{Quorum: true}, 1, 1},
+		{"First under Quorum", RequestAllOptions{First: 2, Quorum: true}, 5, 3},
+		{"First over Quorum", RequestAllOptions{First: 4, Quorum: true}, 5, 4},
+		{"First over connections with Quorum", RequestAllOptions{First: 7, Quorum: true}, 5, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.options.needed(tt.n); got != tt.want {
+				t.Fatalf("needed(%d) = %d; want %d", tt.n, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequestAll(t *testing.T) {
+	tests := []struct {
+		name        string
+		options     []RequestAllOptions
+		wantReplies int
+		wantErrors  []uint64 // connections with ctx error
+		wantErr     bool
+	}{
+		{"all with pending", nil, 2, []uint64{3, 4}, true},
+		{"Quorum with pending", []RequestAllOptions{{Quorum: true}}, 2, []uint64{3, 4}, true},
+		{"First reached", []RequestAllOptions{{First: 2}}, 2, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			channel := NewChannel()
+			for id := uint64(1); id <= 4; id++ {
+				conn := &replyConn{replying: id <= 2}
+				conn.c = newConnection(id, channel, conn, nil, &HandshakeInfo{Header: http.Header{}, userID: "a"})
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+
+			report := channel.User("a").RequestAll(ctx, "cmd", "data", tt.options...)
+			if len(report.Replies) != tt.wantReplies {
+				t.Fatalf("%d replies; want %d", len(report.Replies), tt.wantReplies)
+			}
+			for _, reply := range report.Replies {
+				if want, _ := json.Marshal(reply.ConnID); string(reply.Data) != string(want) {
+					t.Fatalf("reply of connection %d is %s; want %s", reply.ConnID, reply.Data, want)
+				}
+			}
+			ids := ConnectionErrors(report.Errors).ConnIDs()
+			sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+			if len(ids) != len(tt.wantErrors) || (len(ids) > 0 && !reflect.DeepEqual(ids, tt.wantErrors)) {
+				t.Fatalf("errors of connections %v; want %v", ids, tt.wantErrors)
+			}
+			for _, err := range report.Errors {
+				if !errors.Is(err, context.DeadlineExceeded) {
+					t.Fatalf("error of connection %d is %v; want context.DeadlineExceeded", err.ConnID, err)
+				}
+			}
+
+			err := report.Err()
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("Err() = %v; want nil", err)
+				}
+				return
+			}
+			e := &RequestAllError{}
+			if !errors.As(err, &e) || e.Replies != tt.wantReplies || e.Needed != report.Needed {
+				t.Fatalf("Err() = %#v; want *RequestAllError with %d of %d replies", err, tt.wantReplies, report.Needed)
+			}
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Fatalf("errors.Is(%v, context.DeadlineExceeded) = false", err)
+			}
+			ce := &ConnectionError{}
+			if !errors.As(err, &ce) || ce.ConnID != 3 && ce.ConnID != 4 {
+				t.Fatalf("errors.As(ConnectionError) = %v; want error of pending connection", ce)
+			}
+		})
+	}
+}
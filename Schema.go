@@ -0,0 +1,355 @@
+package ws
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+type (
+	// Schema is JSON Schema of command message. Supported keywords: type, properties, required,
+	// additionalProperties, items, enum, const, minimum, maximum, exclusiveMinimum, exclusiveMaximum,
+	// multipleOf, minLength, maxLength, pattern, minItems, maxItems, uniqueItems, allOf, anyOf, oneOf, not
+	Schema struct {
+		Type                 schemaTypes        `json:"type,omitempty"`
+		Properties           map[string]*Schema `json:"properties,omitempty"`
+		Required             []string           `json:"required,omitempty"`
+		AdditionalProperties json.RawMessage    `json:"additionalProperties,omitempty"`
+		Items                *Schema            `json:"items,omitempty"`
+		Enum                 []interface{}      `json:"enum,omitempty"`
+		Const                json.RawMessage    `json:"const,omitempty"`
+		Minimum              *float64           `json:"minimum,omitempty"`
+		Maximum              *float64           `json:"maximum,omitempty"`
+		ExclusiveMinimum     *float64           `json:"exclusiveMinimum,omitempty"`
+		ExclusiveMaximum     *float64           `json:"exclusiveMaximum,omitempty"`
+		MultipleOf           *float64           `json:"multipleOf,omitempty"`
+		MinLength            *int               `json:"minLength,omitempty"`
+		MaxLength            *int               `json:"maxLength,omitempty"`
+		Pattern              string             `json:"pattern,omitempty"`
+		MinItems             *int               `json:"minItems,omitempty"`
+		MaxItems             *int               `json:"maxItems,omitempty"`
+		UniqueItems          bool               `json:"uniqueItems,omitempty"`
+		AllOf                []*Schema          `json:"allOf,omitempty"`
+		AnyOf                []*Schema          `json:"anyOf,omitempty"`
+		OneOf                []*Schema          `json:"oneOf,omitempty"`
+		Not                  *Schema            `json:"not,omitempty"`
+
+		pattern       *regexp.Regexp
+		noAdditional  bool    // "additionalProperties": false
+		additional    *Schema // "additionalProperties": {...}
+		constValue    interface{}
+		hasConstValue bool
+	}
+
+	// schemaTypes is "type" keyword value ("string" or ["string", "null"])
+	schemaTypes []string
+
+	// FieldError is validation error of message field (Path is JSON Pointer: "/items/0/name")
+	FieldError struct {
+		Path    string `json:"path"`
+		Message string `json:"message"`
+	}
+
+	// ValidationError is returned by Schema.Validate
+	ValidationError struct {
+		Fields []FieldError
+	}
+)
+
+// ParseSchema parses and compiles JSON Schema
+func ParseSchema(data []byte) (*Schema, error) {
+	s := &Schema{}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("ws: schema: %v", err)
+	}
+	if err := s.compile(); err != nil {
+		return nil, fmt.Errorf("ws: schema: %v", err)
+	}
+	return s, nil
+}
+
+// LoadSchema reads JSON Schema file
+func LoadSchema(path string) (*Schema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSchema(data)
+}
+
+// MustLoadSchema is LoadSchema which panics on error (for package level variables)
+func MustLoadSchema(path string) *Schema {
+	s, err := LoadSchema(path)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// Validate returns middleware which rejects messages invalid for schema with ErrCodeValidation error reply
+// (panics if schema is nil)
+func Validate(schema *Schema) Middleware {
+	if schema == nil {
+		panic("ws: Validate: nil schema")
+	}
+	return func(next Handler) Handler {
+		return func(a *Adapter) {
+			var data []byte
+			if a.data != nil {
+				data = *a.data
+			}
+			if err := schema.Validate(data); err != nil {
+				a.SendError(NewError(ErrCodeValidation, "validation failed", err.(*ValidationError).Fields))
+				return
+			}
+			next(a)
+		}
+	}
+}
+
+func (e *ValidationError) Error() string {
+	strs := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		strs[i] = f.Path + ": " + f.Message
+	}
+	return "validation failed: " + strings.Join(strs, "; ")
+}
+
+func (t *schemaTypes) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*t = schemaTypes{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return fmt.Errorf("\"type\" must be string or array of strings")
+	}
+	*t = many
+	return nil
+}
+
+// compile prepares patterns and "additionalProperties" and "const" keywords of schema and subschemas
+func (s *Schema) compile() error {
+	if s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("pattern %q: %v", s.Pattern, err)
+		}
+		s.pattern = re
+	}
+	if len(s.AdditionalProperties) > 0 {
+		var allowed bool
+		if err := json.Unmarshal(s.AdditionalProperties, &allowed); err == nil {
+			s.noAdditional = !allowed
+		} else {
+			s.additional = &Schema{}
+			if err := json.Unmarshal(s.AdditionalProperties, s.additional); err != nil {
+				return fmt.Errorf("additionalProperties: %v", err)
+			}
+		}
+	}
+	if len(s.Const) > 0 {
+		if err := json.Unmarshal(s.Const, &s.constValue); err != nil {
+			return fmt.Errorf("const: %v", err)
+		}
+		s.hasConstValue = true
+	}
+
+	subs := []*Schema{s.Items, s.Not, s.additional}
+	for _, p := range s.Properties {
+		subs = append(subs, p)
+	}
+	subs = append(subs, s.AllOf...)
+	subs = append(subs, s.AnyOf...)
+	subs = append(subs, s.OneOf...)
+	for _, sub := range subs {
+		if sub != nil {
+			if err := sub.compile(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Validate checks JSON message and returns *ValidationError with all invalid fields
+func (s *Schema) Validate(data []byte) error {
+	var v interface{}
+	if len(bytes.TrimSpace(data)) > 0 {
+		if err := json.Unmarshal(data, &v); err != nil {
+			return &ValidationError{Fields: []FieldError{{Path: "", Message: "invalid JSON: " + err.Error()}}}
+		}
+	}
+	if errs := s.validate("", v); len(errs) > 0 {
+		return &ValidationError{Fields: errs}
+	}
+	return nil
+}
+
+func (s *Schema) validate(path string, v interface{}) (errs []FieldError) {
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, FieldError{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if len(s.Type) > 0 && !s.matchType(v) {
+		fail("must be %s", strings.Join(s.Type, " or "))
+		return
+	}
+	if len(s.Enum) > 0 && !containsValue(s.Enum, v) {
+		fail("must be one of allowed values")
+	}
+	if s.hasConstValue && !reflect.DeepEqual(s.constValue, v) {
+		fail("must be equal to constant")
+	}
+
+	switch val := v.(type) {
+	case float64:
+		if s.Minimum != nil && val < *s.Minimum {
+			fail("must be >= %v", *s.Minimum)
+		}
+		if s.Maximum != nil && val > *s.Maximum {
+			fail("must be <= %v", *s.Maximum)
+		}
+		if s.ExclusiveMinimum != nil && val <= *s.ExclusiveMinimum {
+			fail("must be > %v", *s.ExclusiveMinimum)
+		}
+		if s.ExclusiveMaximum != nil && val >= *s.ExclusiveMaximum {
+			fail("must be < %v", *s.ExclusiveMaximum)
+		}
+		if s.MultipleOf != nil && *s.MultipleOf != 0 {
+			if q := val / *s.MultipleOf; q != math.Trunc(q) {
+				fail("must be multiple of %v", *s.MultipleOf)
+			}
+		}
+	case string:
+		n := utf8.RuneCountInString(val)
+		if s.MinLength != nil && n < *s.MinLength {
+			fail("must be at least %d characters long", *s.MinLength)
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			fail("must be at most %d characters long", *s.MaxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(val) {
+			fail("must match pattern %q", s.Pattern)
+		}
+	case []interface{}:
+		if s.MinItems != nil && len(val) < *s.MinItems {
+			fail("must have at least %d items", *s.MinItems)
+		}
+		if s.MaxItems != nil && len(val) > *s.MaxItems {
+			fail("must have at most %d items", *s.MaxItems)
+		}
+		if s.UniqueItems {
+			for i := range val {
+				if containsValue(val[:i], val[i]) {
+					fail("must have unique items")
+					break
+				}
+			}
+		}
+		if s.Items != nil {
+			for i, item := range val {
+				errs = append(errs, s.Items.validate(path+"/"+strconv.Itoa(i), item)...)
+			}
+		}
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := val[name]; !ok {
+				errs = append(errs, FieldError{Path: path + "/" + escapePointer(name), Message: "is required"})
+			}
+		}
+		keys := make([]string, 0, len(val))
+		for key := range val {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			keyPath := path + "/" + escapePointer(key)
+			if p, ok := s.Properties[key]; ok {
+				errs = append(errs, p.validate(keyPath, val[key])...)
+			} else if s.noAdditional {
+				errs = append(errs, FieldError{Path: keyPath, Message: "is not allowed"})
+			} else if s.additional != nil {
+				errs = append(errs, s.additional.validate(keyPath, val[key])...)
+			}
+		}
+	}
+
+	for _, sub := range s.AllOf {
+		errs = append(errs, sub.validate(path, v)...)
+	}
+	if len(s.AnyOf) > 0 && s.countValid(s.AnyOf, v) == 0 {
+		fail("must match at least one of schemas")
+	}
+	if len(s.OneOf) > 0 && s.countValid(s.OneOf, v) != 1 {
+		fail("must match exactly one of schemas")
+	}
+	if s.Not != nil && len(s.Not.validate(path, v)) == 0 {
+		fail("must not match schema")
+	}
+	return
+}
+
+func (s *Schema) countValid(schemas []*Schema, v interface{}) (n int) {
+	for _, sub := range schemas {
+		if len(sub.validate("", v)) == 0 {
+			n++
+		}
+	}
+	return
+}
+
+func (s *Schema) matchType(v interface{}) bool {
+	for _, t := range s.Type {
+		switch val := v.(type) {
+		case nil:
+			if t == "null" {
+				return true
+			}
+		case bool:
+			if t == "boolean" {
+				return true
+			}
+		case float64:
+			if t == "number" || t == "integer" && val == math.Trunc(val) {
+				return true
+			}
+		case string:
+			if t == "string" {
+				return true
+			}
+		case []interface{}:
+			if t == "array" {
+				return true
+			}
+		case map[string]interface{}:
+			if t == "object" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func containsValue(list []interface{}, v interface{}) bool {
+	for _, item := range list {
+		if reflect.DeepEqual(item, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// escapePointer escapes JSON Pointer token ("~" and "/")
+func escapePointer(token string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(token)
+}
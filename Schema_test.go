@@ -0,0 +1,79 @@
+package ws
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSchemaValidate(t *testing.T) {
+	schema, err := ParseSchema([]byte(`{
+		"type": "object",
+		"required": ["name", "items"],
+		"additionalProperties": false,
+		"properties": {
+			"name": {"type": "string", "minLength": 2, "maxLength": 5, "pattern": "^[a-z]+$"},
+			"age": {"type": "integer", "minimum": 0, "exclusiveMaximum": 150},
+			"kind": {"enum": ["a", "b"]},
+			"version": {"const": 2},
+			"price": {"type": "number", "multipleOf": 0.5},
+			"tags": {"type": "array", "maxItems": 2, "uniqueItems": true, "items": {"type": "string"}},
+			"items": {"type": "array", "minItems": 1, "items": {"type": "object", "required": ["id"], "properties": {"id": {"type": "integer"}}}},
+			"a/b": {"type": ["string", "null"]},
+			"id": {"oneOf": [{"type": "integer"}, {"type": "string", "minLength": 3}]},
+			"ref": {"anyOf": [{"type": "integer"}, {"type": "null"}]},
+			"code": {"allOf": [{"type": "string"}, {"maxLength": 3}], "not": {"const": "xxx"}}
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		data string
+		want []FieldError
+	}{
+		{`{"name": "bob", "items": [{"id": 1}]}`, nil},
+		{`{"name": "bob", "items": [{"id": 1}], "age": 30, "kind": "a", "version": 2, "price": 1.5, "tags": ["x", "y"], "a/b": null, "id": "abc", "ref": 1, "code": "ab"}`, nil},
+		{``, []FieldError{{"", "must be object"}}},
+		{`{"name": `, []FieldError{{"", "invalid JSON: unexpected end of JSON input"}}},
+		{`[]`, []FieldError{{"", "must be object"}}},
+		{`{}`, []FieldError{{"/name", "is required"}, {"/items", "is required"}}},
+		{`{"name": "B", "items": []}`, []FieldError{{"/items", "must have at least 1 items"}, {"/name", "must be at least 2 characters long"}, {"/name", "must match pattern \"^[a-z]+$\""}}},
+		{`{"name": "bobbie", "items": [{"id": 1.5}, {}]}`, []FieldError{{"/items/0/id", "must be integer"}, {"/items/1/id", "is required"}, {"/name", "must be at most 5 characters long"}}},
+		{`{"name": "bob", "items": [{"id": 1}], "age": 150, "kind": "c", "version": 3}`, []FieldError{{"/age", "must be < 150"}, {"/kind", "must be one of allowed values"}, {"/version", "must be equal to constant"}}},
+		{`{"name": "bob", "items": [{"id": 1}], "age": -1, "price": 1.2, "tags": ["x", "x", "y"]}`, []FieldError{{"/age", "must be >= 0"}, {"/price", "must be multiple of 0.5"}, {"/tags", "must have at most 2 items"}, {"/tags", "must have unique items"}}},
+		{`{"name": "bob", "items": [{"id": 1}], "a/b": 1, "extra": true}`, []FieldError{{"/a~1b", "must be string or null"}, {"/extra", "is not allowed"}}},
+		{`{"name": "bob", "items": [{"id": 1}], "id": "ab", "ref": "x", "code": "xxx"}`, []FieldError{{"/code", "must not match schema"}, {"/id", "must match exactly one of schemas"}, {"/ref", "must match at least one of schemas"}}},
+		{`{"name": "bob", "items": [{"id": 1}], "code": "abcd"}`, []FieldError{{"/code", "must be at most 3 characters long"}}},
+	}
+	for _, tt := range tests {
+		var fields []FieldError
+		if err := schema.Validate([]byte(tt.data)); err != nil {
+			verr, ok := err.(*ValidationError)
+			if !ok {
+				t.Fatalf("Validate(%s) error type = %T; want *ValidationError", tt.data, err)
+			}
+			fields = verr.Fields
+		}
+		if !reflect.DeepEqual(fields, tt.want) {
+			t.Errorf("Validate(%s) = %v; want %v", tt.data, fields, tt.want)
+		}
+	}
+}
+
+func TestParseSchemaError(t *testing.T) {
+	for _, data := range []string{`{"type": 1}`, `{"pattern": "("}`, `{"properties": {"a": {"pattern": "["}}}`, `not json`} {
+		if _, err := ParseSchema([]byte(data)); err == nil {
+			t.Errorf("ParseSchema(%s) = nil error; want error", data)
+		}
+	}
+}
+
+func TestValidateNilSchema(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Validate(nil) didn't panic")
+		}
+	}()
+	Validate(nil)
+}
@@ -0,0 +1,49 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// Requester is implemented by Client (requests to server) and Connection (requests to client)
+type Requester interface {
+	Request(command string, message interface{}, timeout ...time.Duration) ([]byte, error)
+}
+
+// Handle registers typed handler of command (Channel, Client or Group): message is decoded to Req,
+// returned Resp is the answer and returned error is error reply (see Adapter.SendError).
+// Messages which aren't requests are handled without answer. Adapter is available with AdapterFromContext.
+func Handle[Req, Resp any](r Reader, command string, fn func(ctx context.Context, req Req) (Resp, error), middlewares ...Middleware) (off func()) {
+	return r.Read(command, func(a *Adapter) {
+		var req Req
+		if a.data != nil && len(*a.data) > 0 {
+			if err := a.JSONData(&req); err != nil {
+				a.SendError(NewError(ErrCodeBadRequest, "invalid message", err.Error()))
+				return
+			}
+		}
+
+		resp, err := fn(a.Ctx(), req)
+		if err != nil {
+			a.SendError(err)
+			return
+		}
+		if a.requestID != 0 {
+			a.Send(resp)
+		}
+	}, middlewares...)
+}
+
+// Call sends typed request (Client to server or Connection to client) and decodes answer to Resp
+func Call[Req, Resp any](r Requester, command string, req Req, timeout ...time.Duration) (Resp, error) {
+	var resp Resp
+	data, err := r.Request(command, req, timeout...)
+	if err != nil {
+		return resp, err
+	}
+	if len(data) > 0 {
+		err = json.Unmarshal(data, &resp)
+	}
+	return resp, err
+}
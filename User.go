@@ -1,19 +1,18 @@
 package ws
 
-import (
-	"errors"
-	"fmt"
-)
+import "context"
 
 // User instance
 type User struct {
-	connMap *connMap
-	id      interface{}
+	*valuesMap // values shared across all user's connections (while user has connections)
+	connMap    *connMap
+	id         interface{}
+	channel    *Channel
 }
 
 // newUser creates new *User instance
-func newUser(userID interface{}) *User {
-	return &User{connMap: newConnMap(), id: userID}
+func newUser(userID interface{}, channel *Channel) *User {
+	return &User{valuesMap: newValuesMap(), connMap: newConnMap(), id: userID, channel: channel}
 }
 
 // ID in users list
@@ -21,18 +20,19 @@ func (u *User) ID() interface{} {
 	return u.id
 }
 
-// Send message to open user's connections
+// Send message to open user's connections (returns *BroadcastError if some of them failed)
 func (u *User) Send(command string, message interface{}) error {
-	errStr := ""
-	for _, connection := range u.connMap.Copy() {
-		if err := connection.Send(command, message); err != nil {
-			errStr += fmt.Sprintf("Connect %d: %v/n", connection.ID(), err)
-		}
-	}
-	if errStr != "" {
-		return errors.New(errStr)
-	}
-	return nil
+	return u.SendReport(command, message).Err()
+}
+
+// SendReport sends message to open user's connections and returns delivery report
+func (u *User) SendReport(command string, message interface{}) DeliveryReport {
+	return broadcast(u.connMap.Copy(), command, message)
+}
+
+// SendWithAck sends message to open user's connections and waits for acknowledgements (see Connection.SendWithAck)
+func (u *User) SendWithAck(ctx context.Context, command string, message interface{}) DeliveryReport {
+	return sendWithAck(ctx, u.connMap.Copy(), command, message)
 }
 
 // Connection by ID (or empty closed if not found)
@@ -15,9 +15,8 @@ func newConnMap() *connMap {
 }
 
 func (m *connMap) Copy() (c map[uint64]*Connection) {
-	c = make(map[uint64]*Connection, len(m.connects))
-
 	m.RLock()
+	c = make(map[uint64]*Connection, len(m.connects))
 	for k := range m.connects {
 		c[k] = m.connects[k]
 	}
@@ -1,53 +1,111 @@
 package connector
 
 import (
-	"fmt"
-	"net/http"
-
-	websocket "github.com/fasthttp-contrib/websocket"
+	"github.com/fasthttp/websocket"
 	"github.com/night-codes/ws"
 	"github.com/valyala/fasthttp"
 )
 
+// Options of connector instance
+type Options struct {
+	// ReadBufferSize and WriteBufferSize are I/O buffer sizes (4096 by default)
+	ReadBufferSize, WriteBufferSize int
+	// AllowedOrigins is list of allowed origins ("https://example.com", "https://*.example.com", "*"),
+	// same origin only if list is empty (see ws.OriginAllowed)
+	AllowedOrigins []string
+	// CheckOrigin overrides AllowedOrigins check
+	CheckOrigin func(ctx *fasthttp.RequestCtx) bool
+	// EnableCompression turns on permessage-deflate negotiation
+	EnableCompression bool
+	// CompressionLevel of permessage-deflate (flate.BestSpeed...flate.BestCompression, 0 is default level)
+	CompressionLevel int
+	// CompressionThreshold is minimal size of compressed messages (smaller messages are sent uncompressed)
+	CompressionThreshold int
+	// Subprotocols of server in order of preference
+	Subprotocols []string
+	// Authenticator checks handshake requests (see ws.Authenticator)
+	Authenticator ws.Authenticator
+	// OnUpgradeError writes refused upgrade response (status and error text by default)
+	OnUpgradeError func(ctx *fasthttp.RequestCtx, status int, err error)
+}
+
 var (
 	// CheckOrigin wsUpgrader function
+	// Deprecated: use Options.CheckOrigin or Options.AllowedOrigins with NewWithOptions
 	CheckOrigin func(request interface{}) bool
 )
 
 // New makes new Channel with "github.com/valyala/fasthttp".RequestCtx
 func New(bufferSizes ...int) (fasthttp.RequestHandler, *ws.Channel) {
+	return NewWithAuth(nil, bufferSizes...)
+}
+
+// NewWithAuth makes new Channel with "github.com/valyala/fasthttp".RequestCtx and handshake Authenticator
+func NewWithAuth(auth ws.Authenticator, bufferSizes ...int) (fasthttp.RequestHandler, *ws.Channel) {
+	options := Options{Authenticator: auth}
+	if len(bufferSizes) > 0 {
+		options.ReadBufferSize = bufferSizes[0]
+		options.WriteBufferSize = bufferSizes[len(bufferSizes)-1]
+	}
+	if CheckOrigin != nil {
+		options.CheckOrigin = func(ctx *fasthttp.RequestCtx) bool {
+			return CheckOrigin(ctx)
+		}
+	}
+	return NewWithOptions(options)
+}
+
+// NewWithOptions makes new Channel with "github.com/valyala/fasthttp".RequestCtx and connector options
+func NewWithOptions(options Options) (fasthttp.RequestHandler, *ws.Channel) {
 	channel := ws.NewChannel()
-	wsupgrader := getFastUpgrader(bufferSizes...)
+	channel.SetAuthenticator(options.Authenticator)
+	channel.CompressionLevel = options.CompressionLevel
+	channel.CompressionThreshold = options.CompressionThreshold
+	if options.OnUpgradeError == nil {
+		options.OnUpgradeError = writeError
+	}
+	wsupgrader := getFastUpgrader(options)
 
 	return func(ctx *fasthttp.RequestCtx) {
-		copyCtx := &fasthttp.RequestCtx{}
-		ctx.Request.CopyTo(&copyCtx.Request)
-		ctx.Response.CopyTo(&copyCtx.Response)
-
-		wsupgrader.Receiver = func(conn *websocket.Conn) {
-			channel.Handler(conn, copyCtx)
-		}
-		if err := wsupgrader.Upgrade(ctx); err != nil {
-			ctx.SetStatusCode(http.StatusBadRequest)
-			fmt.Fprintf(ctx, "Failed to set websocket upgrade.")
+		info := ws.NewFastHandshakeInfo(ctx)
+		if err := channel.Prepare(info, ctx.UserValue("userID")); err != nil {
+			if retryAfter := err.RetryAfterHeader(); retryAfter != "" {
+				ctx.Response.Header.Set("Retry-After", retryAfter)
+			}
+			options.OnUpgradeError(ctx, err.Status, err)
+			return
 		}
+		// RequestCtx is reused by fasthttp after upgrade, so *ws.HandshakeInfo is connection NetContext
+		wsupgrader.Upgrade(ctx, func(conn *websocket.Conn) {
+			channel.Handler(conn, info, info)
+		})
 	}, channel
 }
 
-func getFastUpgrader(bufferSizes ...int) *websocket.Upgrader {
-	if len(bufferSizes) == 0 {
-		bufferSizes = append(bufferSizes, 4096, 4096)
-	} else if len(bufferSizes) == 1 {
-		bufferSizes = append(bufferSizes, bufferSizes[0])
+func getFastUpgrader(options Options) *websocket.FastHTTPUpgrader {
+	if options.ReadBufferSize <= 0 {
+		options.ReadBufferSize = 4096
 	}
-	socket := &websocket.Upgrader{
-		ReadBufferSize:  bufferSizes[0],
-		WriteBufferSize: bufferSizes[1],
+	if options.WriteBufferSize <= 0 {
+		options.WriteBufferSize = 4096
 	}
-	if CheckOrigin != nil {
-		socket.CheckOrigin = func(r *fasthttp.RequestCtx) bool {
-			return CheckOrigin(r)
+	socket := &websocket.FastHTTPUpgrader{
+		ReadBufferSize:    options.ReadBufferSize,
+		WriteBufferSize:   options.WriteBufferSize,
+		Subprotocols:      options.Subprotocols,
+		CheckOrigin:       options.CheckOrigin,
+		Error:             options.OnUpgradeError,
+		EnableCompression: options.EnableCompression,
+	}
+	if socket.CheckOrigin == nil {
+		socket.CheckOrigin = func(ctx *fasthttp.RequestCtx) bool {
+			return ws.OriginAllowed(string(ctx.Request.Header.Peek("Origin")), string(ctx.Host()), options.AllowedOrigins)
 		}
 	}
 	return socket
 }
+
+func writeError(ctx *fasthttp.RequestCtx, status int, err error) {
+	ctx.SetStatusCode(status)
+	ctx.SetBodyString(err.Error())
+}
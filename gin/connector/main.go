@@ -8,40 +8,113 @@ import (
 	"github.com/night-codes/ws"
 )
 
+// Options of connector instance
+type Options struct {
+	// ReadBufferSize and WriteBufferSize are I/O buffer sizes (4096 by default)
+	ReadBufferSize, WriteBufferSize int
+	// AllowedOrigins is list of allowed origins ("https://example.com", "https://*.example.com", "*"),
+	// same origin only if list is empty (see ws.OriginAllowed)
+	AllowedOrigins []string
+	// CheckOrigin overrides AllowedOrigins check
+	CheckOrigin func(r *http.Request) bool
+	// EnableCompression turns on permessage-deflate negotiation
+	EnableCompression bool
+	// CompressionLevel of permessage-deflate (flate.BestSpeed...flate.BestCompression, 0 is default level)
+	CompressionLevel int
+	// CompressionThreshold is minimal size of compressed messages (smaller messages are sent uncompressed)
+	CompressionThreshold int
+	// Subprotocols of server in order of preference
+	Subprotocols []string
+	// Authenticator checks handshake requests (see ws.Authenticator)
+	Authenticator ws.Authenticator
+	// OnUpgradeError writes refused upgrade response (status and error text by default)
+	OnUpgradeError func(c *gin.Context, status int, err error)
+}
+
 var (
 	// CheckOrigin wsUpgrader function
+	// Deprecated: use Options.CheckOrigin or Options.AllowedOrigins with NewWithOptions
 	CheckOrigin func(request interface{}) bool
 )
 
 // New makes new Channel with "github.com/gin-gonic/gin"
 func New(bufferSizes ...int) (gin.HandlerFunc, *ws.Channel) {
+	return NewWithAuth(nil, bufferSizes...)
+}
+
+// NewWithAuth makes new Channel with "github.com/gin-gonic/gin" and handshake Authenticator
+func NewWithAuth(auth ws.Authenticator, bufferSizes ...int) (gin.HandlerFunc, *ws.Channel) {
+	options := Options{Authenticator: auth}
+	if len(bufferSizes) > 0 {
+		options.ReadBufferSize = bufferSizes[0]
+		options.WriteBufferSize = bufferSizes[len(bufferSizes)-1]
+	}
+	if CheckOrigin != nil {
+		options.CheckOrigin = func(r *http.Request) bool {
+			return CheckOrigin(r)
+		}
+	}
+	return NewWithOptions(options)
+}
+
+// NewWithOptions makes new Channel with "github.com/gin-gonic/gin" and connector options
+func NewWithOptions(options Options) (gin.HandlerFunc, *ws.Channel) {
 	channel := ws.NewChannel()
-	wsupgrader := getWsupgrader(bufferSizes...)
+	channel.SetAuthenticator(options.Authenticator)
+	channel.CompressionLevel = options.CompressionLevel
+	channel.CompressionThreshold = options.CompressionThreshold
+	if options.OnUpgradeError == nil {
+		options.OnUpgradeError = writeError
+	}
+	wsupgrader := getWsupgrader(options)
+
 	return func(c *gin.Context) {
+		info := ws.NewHandshakeInfo(c.Request)
+		userID, _ := c.Get("userID")
+		if err := channel.Prepare(info, userID); err != nil {
+			if retryAfter := err.RetryAfterHeader(); retryAfter != "" {
+				c.Header("Retry-After", retryAfter)
+			}
+			options.OnUpgradeError(c, err.Status, err)
+			c.Abort()
+			return
+		}
 		cc := c.Copy()
-		if conn, err := wsupgrader.Upgrade(c.Writer, c.Request, nil); err == nil {
-			channel.Handler(conn, cc)
+		upgrader := *wsupgrader
+		upgrader.Error = func(w http.ResponseWriter, r *http.Request, status int, reason error) {
+			options.OnUpgradeError(c, status, reason)
+		}
+		if conn, err := upgrader.Upgrade(c.Writer, c.Request, nil); err == nil {
+			channel.Handler(conn, cc, info)
 		} else {
-			c.String(http.StatusBadRequest, "Failed to set websocket upgrade.")
+			c.Abort()
 		}
 	}, channel
 }
 
 // getWsupgrader create new *websocket.Upgrader
-func getWsupgrader(bufferSizes ...int) *websocket.Upgrader {
-	if len(bufferSizes) == 0 {
-		bufferSizes = append(bufferSizes, 4096, 4096)
-	} else if len(bufferSizes) == 1 {
-		bufferSizes = append(bufferSizes, bufferSizes[0])
+func getWsupgrader(options Options) *websocket.Upgrader {
+	if options.ReadBufferSize <= 0 {
+		options.ReadBufferSize = 4096
+	}
+	if options.WriteBufferSize <= 0 {
+		options.WriteBufferSize = 4096
 	}
 	socket := &websocket.Upgrader{
-		ReadBufferSize:  bufferSizes[0],
-		WriteBufferSize: bufferSizes[1],
+		ReadBufferSize:    options.ReadBufferSize,
+		WriteBufferSize:   options.WriteBufferSize,
+		EnableCompression: options.EnableCompression,
+		Subprotocols:      options.Subprotocols,
+		CheckOrigin:       options.CheckOrigin,
 	}
-	if CheckOrigin != nil {
+	if socket.CheckOrigin == nil {
 		socket.CheckOrigin = func(r *http.Request) bool {
-			return CheckOrigin(r)
+			return ws.OriginAllowed(r.Header.Get("Origin"), r.Host, options.AllowedOrigins)
 		}
 	}
 	return socket
 }
+
+func writeError(c *gin.Context, status int, err error) {
+	c.String(status, err.Error())
+}
@@ -1,14 +1,14 @@
 module github.com/night-codes/ws
 
-go 1.16
+go 1.18
 
 require (
-	github.com/fasthttp-contrib/websocket v0.0.0-20160511215533-1f3b11f56072
+	github.com/fasthttp/websocket v1.5.3
 	github.com/gin-gonic/gin v1.7.4
 	github.com/gorilla/websocket v1.4.2
 	github.com/night-codes/conv v1.0.2
 	github.com/night-codes/events v1.0.2
 	github.com/night-codes/tokay v1.4.2
 	github.com/night-codes/tokay-websocket v1.0.0
-	github.com/valyala/fasthttp v1.34.0
+	github.com/valyala/fasthttp v1.47.0
 )
@@ -8,39 +8,105 @@ import (
 	"github.com/night-codes/ws"
 )
 
+// Options of connector instance
+type Options struct {
+	// ReadBufferSize and WriteBufferSize are I/O buffer sizes (4096 by default)
+	ReadBufferSize, WriteBufferSize int
+	// AllowedOrigins is list of allowed origins ("https://example.com", "https://*.example.com", "*"),
+	// same origin only if list is empty (see ws.OriginAllowed)
+	AllowedOrigins []string
+	// CheckOrigin overrides AllowedOrigins check
+	CheckOrigin func(r *http.Request) bool
+	// EnableCompression turns on permessage-deflate negotiation
+	EnableCompression bool
+	// CompressionLevel of permessage-deflate (flate.BestSpeed...flate.BestCompression, 0 is default level)
+	CompressionLevel int
+	// CompressionThreshold is minimal size of compressed messages (smaller messages are sent uncompressed)
+	CompressionThreshold int
+	// Subprotocols of server in order of preference
+	Subprotocols []string
+	// Authenticator checks handshake requests (see ws.Authenticator)
+	Authenticator ws.Authenticator
+	// OnUpgradeError writes refused upgrade response (status and error text by default)
+	OnUpgradeError func(w http.ResponseWriter, r *http.Request, status int, err error)
+}
+
 var (
 	// CheckOrigin wsUpgrader function
+	// Deprecated: use Options.CheckOrigin or Options.AllowedOrigins with NewWithOptions
 	CheckOrigin func(request interface{}) bool
 )
 
 // New makes new Channel with "net/http".Request
 func New(bufferSizes ...int) (http.HandlerFunc, *ws.Channel) {
+	return NewWithAuth(nil, bufferSizes...)
+}
+
+// NewWithAuth makes new Channel with "net/http".Request and handshake Authenticator
+func NewWithAuth(auth ws.Authenticator, bufferSizes ...int) (http.HandlerFunc, *ws.Channel) {
+	options := Options{Authenticator: auth}
+	if len(bufferSizes) > 0 {
+		options.ReadBufferSize = bufferSizes[0]
+		options.WriteBufferSize = bufferSizes[len(bufferSizes)-1]
+	}
+	if CheckOrigin != nil {
+		options.CheckOrigin = func(r *http.Request) bool {
+			return CheckOrigin(r)
+		}
+	}
+	return NewWithOptions(options)
+}
+
+// NewWithOptions makes new Channel with "net/http".Request and connector options
+func NewWithOptions(options Options) (http.HandlerFunc, *ws.Channel) {
 	channel := ws.NewChannel()
-	wsupgrader := getWsupgrader(bufferSizes...)
+	channel.SetAuthenticator(options.Authenticator)
+	channel.CompressionLevel = options.CompressionLevel
+	channel.CompressionThreshold = options.CompressionThreshold
+	if options.OnUpgradeError == nil {
+		options.OnUpgradeError = writeError
+	}
+	wsupgrader := getWsupgrader(options)
+
 	return func(w http.ResponseWriter, r *http.Request) {
+		info := ws.NewHandshakeInfo(r)
+		if err := channel.Prepare(info, r.Context().Value("userID")); err != nil {
+			if retryAfter := err.RetryAfterHeader(); retryAfter != "" {
+				w.Header().Set("Retry-After", retryAfter)
+			}
+			options.OnUpgradeError(w, r, err.Status, err)
+			return
+		}
 		if conn, err := wsupgrader.Upgrade(w, r, nil); err == nil {
-			channel.Handler(conn, r)
-		} else {
-			w.WriteHeader(http.StatusBadRequest)
-			io.WriteString(w, "Failed to set websocket upgrade.\n")
+			channel.Handler(conn, r, info)
 		}
 	}, channel
 }
 
-func getWsupgrader(bufferSizes ...int) *websocket.Upgrader {
-	if len(bufferSizes) == 0 {
-		bufferSizes = append(bufferSizes, 4096, 4096)
-	} else if len(bufferSizes) == 1 {
-		bufferSizes = append(bufferSizes, bufferSizes[0])
+func getWsupgrader(options Options) *websocket.Upgrader {
+	if options.ReadBufferSize <= 0 {
+		options.ReadBufferSize = 4096
+	}
+	if options.WriteBufferSize <= 0 {
+		options.WriteBufferSize = 4096
 	}
 	socket := &websocket.Upgrader{
-		ReadBufferSize:  bufferSizes[0],
-		WriteBufferSize: bufferSizes[1],
+		ReadBufferSize:    options.ReadBufferSize,
+		WriteBufferSize:   options.WriteBufferSize,
+		EnableCompression: options.EnableCompression,
+		Subprotocols:      options.Subprotocols,
+		CheckOrigin:       options.CheckOrigin,
+		Error:             options.OnUpgradeError,
 	}
-	if CheckOrigin != nil {
+	if socket.CheckOrigin == nil {
 		socket.CheckOrigin = func(r *http.Request) bool {
-			return CheckOrigin(r)
+			return ws.OriginAllowed(r.Header.Get("Origin"), r.Host, options.AllowedOrigins)
 		}
 	}
 	return socket
 }
+
+func writeError(w http.ResponseWriter, r *http.Request, status int, err error) {
+	w.WriteHeader(status)
+	io.WriteString(w, err.Error()+"\n")
+}
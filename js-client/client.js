@@ -29,6 +29,8 @@
 		var requestTimeout = 30;
 		var self = this;		
 		var waitOk = {};
+		var received = {}; // IDs of reliable messages
+		var receivedOrder = [];
 
 		var cid = "" + (Math.random().toFixed(16).substring(2) + new Date().valueOf()) + url;
 
@@ -87,17 +89,54 @@
 					return;
 				}
 
+				if (result && result.command === "ws-reliable" && result.data) {
+					reliable(result);
+					return;
+				}
+
 				if (result && result.command) {
+					var command = result.namespace ? result.namespace + "|" + result.command : result.command;
 					if (result.requestID > 0) {
-						trigger("request:" + result.command + ":" + result.requestID, result.data);
+						if (result.error) {
+							var err = new Error(result.error.message);
+							err.code = result.error.code;
+							err.details = result.error.details;
+							trigger("request:" + command + ":" + result.requestID, err);
+							return;
+						}
+						trigger("request:" + command + ":" + result.requestID, result.data);
 					} else {
-						trigger("read:" + result.command, result);
+						trigger("read:" + command, result);
 					}
-					trigger("came", result.command);
-					waitOk[result.command] = true;
+					trigger("came", command);
+					waitOk[command] = true;
 				}
 			}
 
+			// reliable message is handled once and acknowledged after handlers
+			function reliable(result) {
+				var prefix = result.namespace ? result.namespace + "|" : "";
+				var id = result.data.id;
+				if (id in received) {
+					if (received[id]) {
+						self.send(prefix + "ws-ack", id);
+					}
+					return;
+				}
+				received[id] = false;
+				receivedOrder.push(id);
+				if (receivedOrder.length > 10000) {
+					delete received[receivedOrder.shift()];
+				}
+				done(JSON.stringify({
+					namespace: result.namespace,
+					command: result.data.command,
+					data: result.data.data
+				}));
+				received[id] = true;
+				self.send(prefix + "ws-ack", id);
+			}
+
 			sock = createWebSocket(url);
 			sock.onopen = function () {
 				trigger('wsConnect');
@@ -190,21 +229,59 @@
 			self.send(command, msg, requestID);
 		};
 
+		// present fresh auth token to the server (callback(ok, err))
+		self.auth = function (token, callback) {
+			self.request("ws-auth", token, callback || function () {});
+		};
+
 		// set request timeout
 		self.setRequestTimeout = function (timeout) {
 			requestTimeout = timeout;
 		};
 
 		// повесить обработчик на сообщения, санкционированные сервером (без запроса)
-		self.subscribe = function (command) {
+		self.subscribe = function (command, prefix) {
+			prefix = prefix || "";
 			if (sock && sock.readyState === WebSocket.OPEN) {
-				self.send("subscribe", command);
+				self.send(prefix + "subscribe", command);
 			}
 			on('wsConnect', function () {
-				self.send("subscribe", command);
+				self.send(prefix + "subscribe", command);
 			});
 		};
 
+		// logical channel multiplexed over the socket (same send, read, request and subscribe API)
+		self.namespace = function (name) {
+			return new Namespace(name + "|");
+		};
+
+		function Namespace(prefix) {
+			var ns = this;
+			ns.send = function (command, msg, requestID) {
+				self.send(prefix + command, msg, requestID);
+			};
+			ns.read = function (command, callback) {
+				self.read(prefix + command, callback);
+			};
+			ns.request = function (command, msg, callback, timeout) {
+				self.request(prefix + command, msg, callback, timeout);
+			};
+			ns.subscribe = function (command) {
+				self.subscribe(command, prefix);
+			};
+			ns.namespace = function (name) {
+				return new Namespace(prefix + name + "|");
+			};
+
+			// join namespace on every connect (server runs namespace connect handlers)
+			if (sock && sock.readyState === WebSocket.OPEN) {
+				self.send(prefix + "ws-join", "");
+			}
+			on('wsConnect', function () {
+				self.send(prefix + "ws-join", "");
+			});
+		}
+
 		self.wait = function (commands, callback) {
 			var cmds = {};
 			commands.forEach(function (command) {
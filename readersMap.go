@@ -1,36 +1,101 @@
 package ws
 
-import "sync"
+import (
+	"strings"
+	"sync"
+)
 
 type (
-	readFunc   func(*Adapter)
 	readersMap struct {
 		sync.RWMutex
-		fns map[string][]readFunc
+		fns    map[string][]Handler
+		ids    map[string][]uint64 // handlers IDs (same order as fns)
+		routes []*route            // parameterized commands ("orders/:id/update", "files/*path")
+		lastID uint64
+	}
+
+	route struct {
+		pattern  string
+		segments []string
+		fns      []Handler
+		ids      []uint64
 	}
 )
 
 func newReaderMap() *readersMap {
-	return &readersMap{fns: make(map[string][]readFunc)}
+	return &readersMap{fns: make(map[string][]Handler), ids: make(map[string][]uint64)}
 }
 
-func (m *readersMap) Set(key string, val readFunc) {
+// Set adds handler of command and returns its ID (for Remove)
+func (m *readersMap) Set(key string, val Handler) uint64 {
 	m.Lock()
 	defer m.Unlock()
-	if _, ok := m.fns[key]; ok {
-		m.fns[key] = append(m.fns[key], val)
+	m.lastID++
+	if isPattern(key) {
+		for _, r := range m.routes {
+			if r.pattern == key {
+				r.fns = append(r.fns, val)
+				r.ids = append(r.ids, m.lastID)
+				return m.lastID
+			}
+		}
+		m.routes = append(m.routes, &route{
+			pattern:  key,
+			segments: strings.Split(key, "/"),
+			fns:      []Handler{val},
+			ids:      []uint64{m.lastID},
+		})
+		return m.lastID
+	}
+	m.fns[key] = append(m.fns[key], val)
+	m.ids[key] = append(m.ids[key], m.lastID)
+	return m.lastID
+}
+
+// Remove deletes one handler of command (handlers slices are copied, so running dispatches are not affected)
+func (m *readersMap) Remove(key string, id uint64) {
+	m.Lock()
+	defer m.Unlock()
+	if isPattern(key) {
+		for i, r := range m.routes {
+			if r.pattern == key {
+				if r.fns, r.ids = without(r.fns, r.ids, id); len(r.fns) == 0 {
+					m.routes = append(m.routes[:i:i], m.routes[i+1:]...)
+				}
+				return
+			}
+		}
 		return
 	}
-	m.fns[key] = []readFunc{val}
+	if m.fns[key], m.ids[key] = without(m.fns[key], m.ids[key], id); len(m.fns[key]) == 0 {
+		delete(m.fns, key)
+		delete(m.ids, key)
+	}
 }
 
+// handle adds handler of command and returns function which removes it
+func (m *readersMap) handle(key string, val Handler) func() {
+	id := m.Set(key, val)
+	return func() {
+		m.Remove(key, id)
+	}
+}
+
+// Delete removes all handlers of command
 func (m *readersMap) Delete(key string) {
 	m.Lock()
 	delete(m.fns, key)
+	delete(m.ids, key)
+	for i, r := range m.routes {
+		if r.pattern == key {
+			m.routes = append(m.routes[:i:i], m.routes[i+1:]...)
+			break
+		}
+	}
 	m.Unlock()
 }
 
-func (m *readersMap) Get(key string) []readFunc {
+func (m *readersMap) Get(key string) []Handler {
 	m.RLock()
 	v, _ := m.fns[key]
 	m.RUnlock()
@@ -40,15 +105,108 @@ func (m *readersMap) Get(key string) []readFunc {
 
 func (m *readersMap) Len() int {
 	m.RLock()
-	n := len(m.fns)
+	n := len(m.fns) + len(m.routes)
 	m.RUnlock()
 
 	return n
 }
 
-func (m *readersMap) GetEx(key string) ([]readFunc, bool) {
+func (m *readersMap) GetEx(key string) ([]Handler, bool) {
 	m.RLock()
 	v, exists := m.fns[key]
 	m.RUnlock()
 	return v, exists
 }
+
+// Match returns handlers of command, its parameters and matched pattern: exact command is preferred,
+// then static segments win over parameters and parameters over wildcards (like gin and tokay routers)
+func (m *readersMap) Match(command string) ([]Handler, map[string]string, string, bool) {
+	m.RLock()
+	defer m.RUnlock()
+	if v, exists := m.fns[command]; exists {
+		return v, nil, command, true
+	}
+
+	var (
+		best       *route
+		bestParams map[string]string
+		bestScore  []int
+	)
+	parts := strings.Split(command, "/")
+	for _, r := range m.routes {
+		params, score, ok := r.match(parts)
+		if ok && (best == nil || betterScore(score, bestScore)) {
+			best, bestParams, bestScore = r, params, score
+		}
+	}
+	if best == nil {
+		return nil, nil, "", false
+	}
+	return best.fns, bestParams, best.pattern, true
+}
+
+// match returns route parameters and segments score (2 is static, 1 is parameter, 0 is wildcard)
+func (r *route) match(parts []string) (map[string]string, []int, bool) {
+	params := map[string]string{}
+	score := make([]int, 0, len(r.segments))
+	for i, seg := range r.segments {
+		switch {
+		case strings.HasPrefix(seg, "*"):
+			params[paramName(seg)] = strings.Join(parts[i:], "/")
+			return params, append(score, 0), true
+		case i >= len(parts):
+			return nil, nil, false
+		case strings.HasPrefix(seg, ":"):
+			if parts[i] == "" {
+				return nil, nil, false
+			}
+			params[seg[1:]] = parts[i]
+			score = append(score, 1)
+		case seg == parts[i]:
+			score = append(score, 2)
+		default:
+			return nil, nil, false
+		}
+	}
+	return params, score, len(parts) == len(r.segments)
+}
+
+// isPattern returns true if command has ":param" or "*wildcard" (last) segments
+func isPattern(command string) bool {
+	for _, seg := range strings.Split(command, "/") {
+		if strings.HasPrefix(seg, ":") || strings.HasPrefix(seg, "*") {
+			return true
+		}
+	}
+	return false
+}
+
+// paramName of wildcard segment ("*" for unnamed wildcard)
+func paramName(seg string) string {
+	if seg == "*" {
+		return seg
+	}
+	return seg[1:]
+}
+
+func betterScore(score, than []int) bool {
+	for i := 0; i < len(score) && i < len(than); i++ {
+		if score[i] != than[i] {
+			return score[i] > than[i]
+		}
+	}
+	return len(score) < len(than) // "a/:b" is better than "a/:b/*rest" for "a/b"
+}
+
+// without returns copies of handlers and IDs slices without handler id
+func without(fns []Handler, ids []uint64, id uint64) ([]Handler, []uint64) {
+	retFns := make([]Handler, 0, len(fns))
+	retIDs := make([]uint64, 0, len(ids))
+	for i := range ids {
+		if ids[i] != id {
+			retFns = append(retFns, fns[i])
+			retIDs = append(retIDs, ids[i])
+		}
+	}
+	return retFns, retIDs
+}
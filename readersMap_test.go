@@ -0,0 +1,63 @@
+package ws
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReadersMapMatch(t *testing.T) {
+	m := newReaderMap()
+	for _, command := range []string{
+		"orders/list",
+		"orders/:id",
+		"orders/:id/update",
+		"orders/new/update",
+		"files/*path",
+		"files/:dir/readme",
+		"users/:id",
+		"users/:id/*rest",
+		"any/*",
+	} {
+		m.Set(command, func(*Adapter) {})
+	}
+
+	tests := []struct {
+		command string
+		pattern string
+		params  map[string]string
+		ok      bool
+	}{
+		{"orders/list", "orders/list", nil, true},
+		{"orders/42", "orders/:id", map[string]string{"id": "42"}, true},
+		{"orders/42/update", "orders/:id/update", map[string]string{"id": "42"}, true},
+		{"orders/new/update", "orders/new/update", nil, true},
+		{"orders/", "", nil, false},
+		{"orders/42/delete", "", nil, false},
+		{"files/a/b/c.txt", "files/*path", map[string]string{"path": "a/b/c.txt"}, true},
+		{"files/docs/readme", "files/:dir/readme", map[string]string{"dir": "docs"}, true},
+		{"users/7", "users/:id", map[string]string{"id": "7"}, true},
+		{"users/7/posts/1", "users/:id/*rest", map[string]string{"id": "7", "rest": "posts/1"}, true},
+		{"any/thing", "any/*", map[string]string{"*": "thing"}, true},
+		{"unknown", "", nil, false},
+	}
+	for _, tt := range tests {
+		_, params, pattern, ok := m.Match(tt.command)
+		if ok != tt.ok || pattern != tt.pattern || !reflect.DeepEqual(params, tt.params) {
+			t.Errorf("Match(%q) = %v, %q, %v; want %v, %q, %v", tt.command, params, pattern, ok, tt.params, tt.pattern, tt.ok)
+		}
+	}
+}
+
+func TestReadersMapRemove(t *testing.T) {
+	m := newReaderMap()
+	id := m.Set("orders/:id", func(*Adapter) {})
+	m.Set("orders/:id", func(*Adapter) {})
+	m.Remove("orders/:id", id)
+	if fns, _, _, ok := m.Match("orders/1"); !ok || len(fns) != 1 {
+		t.Fatalf("Match after Remove = %d handlers, %v; want 1, true", len(fns), ok)
+	}
+	m.Delete("orders/:id")
+	if _, _, _, ok := m.Match("orders/1"); ok {
+		t.Fatal("Match after Delete = true; want false")
+	}
+}
@@ -5,15 +5,15 @@ import "sync"
 type (
 	requestsMap struct {
 		sync.RWMutex
-		fns map[int64]readFunc
+		fns map[int64]Handler
 	}
 )
 
 func newRequestsMap() *requestsMap {
-	return &requestsMap{fns: make(map[int64]readFunc)}
+	return &requestsMap{fns: make(map[int64]Handler)}
 }
 
-func (m *requestsMap) Set(key int64, val readFunc) {
+func (m *requestsMap) Set(key int64, val Handler) {
 	m.Lock()
 	defer m.Unlock()
 
@@ -25,7 +25,7 @@ func (m *requestsMap) Delete(key int64) {
 	m.Unlock()
 }
 
-func (m *requestsMap) Get(key int64) readFunc {
+func (m *requestsMap) Get(key int64) Handler {
 	m.RLock()
 	v, _ := m.fns[key]
 	m.RUnlock()
@@ -41,7 +41,7 @@ func (m *requestsMap) Len() int {
 	return n
 }
 
-func (m *requestsMap) GetEx(key int64) (readFunc, bool) {
+func (m *requestsMap) GetEx(key int64) (Handler, bool) {
 	m.RLock()
 	v, exists := m.fns[key]
 	m.RUnlock()
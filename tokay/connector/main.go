@@ -1,50 +1,142 @@
 package connector
 
 import (
-	"net/http"
-
+	"github.com/fasthttp/websocket"
 	"github.com/night-codes/tokay"
 	tokayWebsocket "github.com/night-codes/tokay-websocket"
 	"github.com/night-codes/ws"
 	"github.com/valyala/fasthttp"
 )
 
+// Options of connector instance
+type Options struct {
+	// ReadBufferSize and WriteBufferSize are I/O buffer sizes (4096 by default)
+	ReadBufferSize, WriteBufferSize int
+	// AllowedOrigins is list of allowed origins ("https://example.com", "https://*.example.com", "*"),
+	// same origin only if list is empty (see ws.OriginAllowed)
+	AllowedOrigins []string
+	// CheckOrigin overrides AllowedOrigins check
+	CheckOrigin func(c *tokay.Context) bool
+	// EnableCompression turns on permessage-deflate negotiation (tokay-websocket has no compression support,
+	// so connections are upgraded with github.com/fasthttp/websocket and tokay.Context.WSConn isn't set)
+	EnableCompression bool
+	// CompressionLevel of permessage-deflate (flate.BestSpeed...flate.BestCompression, 0 is default level)
+	CompressionLevel int
+	// CompressionThreshold is minimal size of compressed messages (smaller messages are sent uncompressed)
+	CompressionThreshold int
+	// Subprotocols of server in order of preference
+	Subprotocols []string
+	// Authenticator checks handshake requests (see ws.Authenticator)
+	Authenticator ws.Authenticator
+	// OnUpgradeError writes refused upgrade response (status and error text by default)
+	OnUpgradeError func(c *tokay.Context, status int, err error)
+}
+
 var (
 	// CheckOrigin wsUpgrader function
+	// Deprecated: use Options.CheckOrigin or Options.AllowedOrigins with NewWithOptions
 	CheckOrigin func(request interface{}) bool
 )
 
 // New makes new Channel with "github.com/night-codes/tokay"
 func New(bufferSizes ...int) (tokay.Handler, *ws.Channel) {
+	return NewWithAuth(nil, bufferSizes...)
+}
+
+// NewWithAuth makes new Channel with "github.com/night-codes/tokay" and handshake Authenticator
+func NewWithAuth(auth ws.Authenticator, bufferSizes ...int) (tokay.Handler, *ws.Channel) {
+	options := Options{Authenticator: auth}
+	if len(bufferSizes) > 0 {
+		options.ReadBufferSize = bufferSizes[0]
+		options.WriteBufferSize = bufferSizes[len(bufferSizes)-1]
+	}
+	if CheckOrigin != nil {
+		options.CheckOrigin = func(c *tokay.Context) bool {
+			return CheckOrigin(c.RequestCtx)
+		}
+	}
+	return NewWithOptions(options)
+}
+
+// NewWithOptions makes new Channel with "github.com/night-codes/tokay" and connector options
+func NewWithOptions(options Options) (tokay.Handler, *ws.Channel) {
 	channel := ws.NewChannel()
-	wsupgrader := getFastUpgrader(bufferSizes...)
+	channel.SetAuthenticator(options.Authenticator)
+	channel.CompressionLevel = options.CompressionLevel
+	channel.CompressionThreshold = options.CompressionThreshold
+	if options.OnUpgradeError == nil {
+		options.OnUpgradeError = writeError
+	}
+	wsupgrader := getFastUpgrader(options)
+	deflateUpgrader := getDeflateUpgrader(wsupgrader)
 
 	return func(c *tokay.Context) {
+		info := ws.NewFastHandshakeInfo(c.RequestCtx)
+		if err := channel.Prepare(info, c.Get("userID")); err != nil {
+			if retryAfter := err.RetryAfterHeader(); retryAfter != "" {
+				c.Response.Header.Set("Retry-After", retryAfter)
+			}
+			options.OnUpgradeError(c, err.Status, err)
+			return
+		}
 		cc := c.Copy()
-		wsupgrader.Receiver = func(conn *tokayWebsocket.Conn) {
-			cc.WSConn = conn
-			channel.Handler(conn, cc)
+		onError := func(ctx *fasthttp.RequestCtx, status int, reason error) {
+			options.OnUpgradeError(c, status, reason)
+		}
+		checkOrigin := wsupgrader.CheckOrigin
+		if options.CheckOrigin != nil {
+			checkOrigin = func(ctx *fasthttp.RequestCtx) bool {
+				return options.CheckOrigin(c)
+			}
+		}
+
+		if options.EnableCompression {
+			upgrader := *deflateUpgrader
+			upgrader.Error = onError
+			upgrader.CheckOrigin = checkOrigin
+			upgrader.Upgrade(c.RequestCtx, func(conn *websocket.Conn) {
+				channel.Handler(conn, cc, info)
+			})
+			return
 		}
-		if err := wsupgrader.Upgrade(c.RequestCtx); err != nil {
-			c.String(http.StatusBadRequest, "Failed to set websocket upgrade.")
+		upgrader := *wsupgrader
+		upgrader.Receiver = func(conn *tokayWebsocket.Conn) {
+			cc.WSConn = conn
+			channel.Handler(conn, cc, info)
 		}
+		upgrader.Error = onError
+		upgrader.CheckOrigin = checkOrigin
+		upgrader.Upgrade(c.RequestCtx)
 	}, channel
 }
 
-func getFastUpgrader(bufferSizes ...int) *tokayWebsocket.Upgrader {
-	if len(bufferSizes) == 0 {
-		bufferSizes = append(bufferSizes, 4096, 4096)
-	} else if len(bufferSizes) == 1 {
-		bufferSizes = append(bufferSizes, bufferSizes[0])
+func getFastUpgrader(options Options) *tokayWebsocket.Upgrader {
+	if options.ReadBufferSize <= 0 {
+		options.ReadBufferSize = 4096
 	}
-	socket := &tokayWebsocket.Upgrader{
-		ReadBufferSize:  bufferSizes[0],
-		WriteBufferSize: bufferSizes[1],
+	if options.WriteBufferSize <= 0 {
+		options.WriteBufferSize = 4096
 	}
-	if CheckOrigin != nil {
-		socket.CheckOrigin = func(r *fasthttp.RequestCtx) bool {
-			return CheckOrigin(r)
-		}
+	return &tokayWebsocket.Upgrader{
+		ReadBufferSize:  options.ReadBufferSize,
+		WriteBufferSize: options.WriteBufferSize,
+		Subprotocols:    options.Subprotocols,
+		CheckOrigin: func(ctx *fasthttp.RequestCtx) bool {
+			return ws.OriginAllowed(string(ctx.Request.Header.Peek("Origin")), string(ctx.Host()), options.AllowedOrigins)
+		},
+	}
+}
+
+// getDeflateUpgrader returns github.com/fasthttp/websocket upgrader with permessage-deflate support
+func getDeflateUpgrader(upgrader *tokayWebsocket.Upgrader) *websocket.FastHTTPUpgrader {
+	return &websocket.FastHTTPUpgrader{
+		ReadBufferSize:    upgrader.ReadBufferSize,
+		WriteBufferSize:   upgrader.WriteBufferSize,
+		Subprotocols:      upgrader.Subprotocols,
+		EnableCompression: true,
 	}
-	return socket
+}
+
+func writeError(c *tokay.Context, status int, err error) {
+	c.String(status, err.Error())
 }
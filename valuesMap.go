@@ -0,0 +1,103 @@
+package ws
+
+import (
+	"sync"
+	"time"
+
+	"github.com/night-codes/conv"
+)
+
+// valuesMap is concurrency-safe key/value store of Connection and User
+type valuesMap struct {
+	valuesMutex sync.RWMutex
+	values      map[string]interface{}
+}
+
+func newValuesMap() *valuesMap {
+	return &valuesMap{values: make(map[string]interface{})}
+}
+
+// Set value by key
+func (m *valuesMap) Set(key string, val interface{}) {
+	m.valuesMutex.Lock()
+	m.values[key] = val
+	m.valuesMutex.Unlock()
+}
+
+// Get value by key
+func (m *valuesMap) Get(key string) (val interface{}, exists bool) {
+	m.valuesMutex.RLock()
+	val, exists = m.values[key]
+	m.valuesMutex.RUnlock()
+	return
+}
+
+// Delete value by key
+func (m *valuesMap) Delete(key string) {
+	m.valuesMutex.Lock()
+	delete(m.values, key)
+	m.valuesMutex.Unlock()
+}
+
+// Values returns copy of all values
+func (m *valuesMap) Values() map[string]interface{} {
+	m.valuesMutex.RLock()
+	c := make(map[string]interface{}, len(m.values))
+	for k := range m.values {
+		c[k] = m.values[k]
+	}
+	m.valuesMutex.RUnlock()
+	return c
+}
+
+// GetString returns value by key converted to string
+func (m *valuesMap) GetString(key string) string {
+	val, _ := m.Get(key)
+	return conv.String(val)
+}
+
+// GetInt returns value by key converted to int
+func (m *valuesMap) GetInt(key string) int {
+	val, _ := m.Get(key)
+	return conv.Int(val)
+}
+
+// GetInt64 returns value by key converted to int64
+func (m *valuesMap) GetInt64(key string) int64 {
+	val, _ := m.Get(key)
+	return conv.Int64(val)
+}
+
+// GetUint64 returns value by key converted to uint64
+func (m *valuesMap) GetUint64(key string) uint64 {
+	val, _ := m.Get(key)
+	return conv.Uint64(val)
+}
+
+// GetFloat64 returns value by key converted to float64
+func (m *valuesMap) GetFloat64(key string) float64 {
+	val, _ := m.Get(key)
+	return conv.Float64(val)
+}
+
+// GetBool returns value by key converted to bool
+func (m *valuesMap) GetBool(key string) bool {
+	val, _ := m.Get(key)
+	return conv.Bool(val)
+}
+
+// GetTime returns time.Time value by key (zero time if value has another type)
+func (m *valuesMap) GetTime(key string) time.Time {
+	val, _ := m.Get(key)
+	t, _ := val.(time.Time)
+	return t
+}
+
+// GetDuration returns time.Duration value by key (numbers are nanoseconds)
+func (m *valuesMap) GetDuration(key string) time.Duration {
+	val, _ := m.Get(key)
+	if d, ok := val.(time.Duration); ok {
+		return d
+	}
+	return time.Duration(conv.Int64(val))
+}